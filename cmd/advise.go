@@ -0,0 +1,163 @@
+// ==========================================================================
+// Command for 'advise' - least privilege advice from activation history
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/advisor"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+)
+
+var adviseDaysFlag int
+var adviseUnusedDaysFlag int
+
+var adviseCmd = &cobra.Command{
+	Use:   "advise",
+	Short: "Suggest least privilege improvements",
+	Long: `Analyse your activation history, to suggest a better default duration for each group,
+and find eligibilities you haven't used recently, so you can give them up`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if adviseDaysFlag <= 0 || adviseUnusedDaysFlag <= 0 {
+			return errors.New("--days and --unused-days must be greater than zero")
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		eligible, err := getEligible(ctx, pimClient)
+		if err != nil {
+			return fmt.Errorf("failed to list eligible PIM groups: %w", err)
+		}
+
+		// History needs to go back far enough to spot unused eligibilities too, but only
+		// the last --days of it are used for the analysis of durations & rates
+		now := time.Now()
+		period := time.Duration(adviseDaysFlag) * 24 * time.Hour
+		history := time.Duration(max(adviseDaysFlag, adviseUnusedDaysFlag)) * 24 * time.Hour
+
+		requests, err := pimClient.ListRequestHistory(ctx, user.ID, now.Add(-history), now)
+		if err != nil {
+			return fmt.Errorf("failed to get request history: %w", err)
+		}
+
+		opts := advisor.DefaultOptions
+		opts.UnusedAfter = time.Duration(adviseUnusedDaysFlag) * 24 * time.Hour
+
+		advice := advisor.Analyse(eligible, pim.Activations(requests, now), period, now, opts)
+		if len(advice) == 0 {
+			output.Printfq("No eligible PIM groups found\n")
+			return nil
+		}
+
+		analysed := 0
+
+		for _, r := range requests {
+			if !r.RequestedDateTime.Before(now.Add(-period)) {
+				analysed++
+			}
+		}
+
+		output.Printf("Analysed %d request(s) over the last %d days:\n\n", analysed, adviseDaysFlag)
+
+		printAdvice(advice)
+
+		return nil
+	},
+}
+
+func init() {
+	adviseCmd.Flags().IntVar(&adviseDaysFlag, "days", 90, "Number of days of history to analyse")
+	adviseCmd.Flags().IntVar(&adviseUnusedDaysFlag, "unused-days", 90, "Flag eligibilities not activated for this many days")
+}
+
+// printAdvice outputs the advice for each group & role, as a table in quiet mode
+func printAdvice(advice []advisor.Advice) {
+	var tbl table.Table
+	if quietMode {
+		tbl = output.NewTable("Group Name", "Role", "Activations", "Per Week", "Typical Use", "Typical Request", "Suggested", "Last Used")
+	}
+
+	for _, adv := range advice {
+		lastUsed := "Never"
+		if !adv.LastActivated.IsZero() {
+			lastUsed = adv.LastActivated.Local().Format("Jan 02 2006")
+		}
+
+		suggested := "-"
+		if adv.Suggested > 0 {
+			suggested = shortDuration(adv.Suggested)
+		}
+
+		if quietMode {
+			tbl.AddRow(adv.Group, adv.Role, adv.Activations, fmt.Sprintf("%.1f", adv.PerWeek),
+				shortDuration(adv.TypicalActual), shortDuration(adv.TypicalRequested), suggested, lastUsed)
+
+			continue
+		}
+
+		output.Printf("%s\n", output.Heading(adv.Group))
+		output.Printf("  %s\t\t%s\n", output.Label("Role:"), adv.Role)
+		output.Printf("  %s\t%d (%.1f per week)\n", output.Label("Activations:"), adv.Activations, adv.PerWeek)
+		output.Printf("  %s\t%s\n", output.Label("Last Used:"), lastUsed)
+
+		if adv.Activations > 0 {
+			output.Printf("  %s\t%s (requested %s)\n", output.Label("Typical Use:"), shortDuration(adv.TypicalActual), shortDuration(adv.TypicalRequested))
+			output.Printf("  %s\t%d of %d\n", output.Label("Ended Early:"), adv.EarlyEnds, adv.Activations)
+		}
+
+		if adv.Suggested > 0 {
+			output.Printf("  %s\tUse --duration %s for this group\n", output.Success("Suggestion:"), shortDuration(adv.Suggested))
+		}
+
+		if adv.NotNeeded {
+			output.Printf("  %s\tMost activations were deactivated almost straight away, is this role needed?\n", output.Success("Suggestion:"))
+		}
+
+		if adv.Unused {
+			output.Printf("  %s\tNot activated in the last %d days, consider giving up this eligibility\n", output.Failure("Unused:"), adviseUnusedDaysFlag)
+		}
+
+		output.Println()
+	}
+
+	if quietMode {
+		tbl.Print()
+	}
+}
+
+// shortDuration formats a duration like '1h30m', or '-' when zero
+func shortDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+
+	d = d.Round(time.Minute)
+	h := d / time.Hour
+	m := (d - h*time.Hour) / time.Minute
+
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	}
+
+	return fmt.Sprintf("%dh%dm", h, m)
+}
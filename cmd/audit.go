@@ -0,0 +1,156 @@
+// ==========================================================================
+// Command for 'audit' - show & verify the local audit journal
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benc-uk/pim-cli/pkg/audit"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+)
+
+var auditLastFlag int
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show & verify the local audit journal",
+	Long:  `Every privileged action taken with this tool is recorded in a local, hash chained, audit journal`,
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the audit journal",
+	Long:  `Show the entries in the local audit journal, oldest first`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		journal, err := audit.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open audit journal: %w", err)
+		}
+
+		entries, err := journal.Entries()
+		if err != nil {
+			return err
+		}
+
+		if auditLastFlag > 0 && len(entries) > auditLastFlag {
+			entries = entries[len(entries)-auditLastFlag:]
+		}
+
+		if len(entries) == 0 {
+			output.Printfq("No audit entries found\n")
+			return nil
+		}
+
+		output.Printf("Journal: %s\n\n", journal.Path())
+
+		var tbl table.Table
+		if quietMode {
+			tbl = output.NewTable("#", "Time", "Action", "Group", "Role", "Duration", "Outcome")
+		}
+
+		for _, e := range entries {
+			timeNice := e.Time.Local().Format("15:04, Jan 02 2006")
+
+			if quietMode {
+				tbl.AddRow(e.Seq, timeNice, e.Action, e.Group, e.Role, e.Duration, e.Outcome)
+				continue
+			}
+
+			outcomeStyle := output.StyleSuccess
+			if e.Outcome != audit.OutcomeSuccess {
+				outcomeStyle = output.StyleFailure
+			}
+
+			output.Printf("%s %s\n", output.Heading(fmt.Sprintf("#%d %s", e.Seq, e.Action)), timeNice)
+			output.Printf("  %s\t\t%s\n", output.Label("User:"), e.User)
+			output.Printf("  %s\t%s (%s)\n", output.Label("Tenant:"), e.Tenant, e.TenantID)
+			output.Printf("  %s\t%s\n", output.Label("Group:"), e.Group)
+			output.Printf("  %s\t\t%s\n", output.Label("Role:"), e.Role)
+
+			if e.Duration != "" {
+				output.Printf("  %s\t%s\n", output.Label("Duration:"), e.Duration)
+			}
+
+			output.Printf("  %s\t%s\n", output.Label("Reason:"), e.Reason)
+			output.Printf("  %s\t%s %s\n", output.Label("Outcome:"), outcomeStyle.Render(e.Outcome), e.Message)
+
+			if e.RequestID != "" {
+				output.Printf("  %s\t%s\n", output.Label("Request ID:"), e.RequestID)
+			}
+
+			output.Println()
+		}
+
+		if quietMode {
+			tbl.Print()
+		}
+
+		return nil
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the audit journal",
+	Long:  `Check the hash chain of the audit journal, to detect any entries that have been edited or deleted`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		journal, err := audit.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open audit journal: %w", err)
+		}
+
+		count, err := journal.Verify()
+		if err != nil {
+			return fmt.Errorf("audit journal verification FAILED after %d valid entries: %w", count, err)
+		}
+
+		output.Printfq("%s, %d entries verified\n", output.Success("Audit journal OK"), count)
+
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditShowCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+
+	auditShowCmd.Flags().IntVar(&auditLastFlag, "last", 0, "Only show the last N entries")
+}
+
+// recordAudit appends a privileged action to the audit journal, filling in the user & tenant,
+// and the outcome from the error returned by the API. Failing to record is reported but not fatal.
+// Nothing is recorded with --replay, as the action never really happened
+func recordAudit(ctx context.Context, graphClient *graph.Client, entry audit.Entry, actionErr error) {
+	if replayFlag != "" {
+		return
+	}
+
+	entry.User = user.UserPrincipalName
+	entry.UserID = user.ID
+	entry.Tenant = tenantName
+	entry.Outcome = audit.OutcomeSuccess
+
+	if claims, err := graphClient.GetTokenClaims(ctx); err == nil {
+		entry.TenantID = claims.TenantID
+	}
+
+	if actionErr != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Message = actionErr.Error()
+	}
+
+	journal, err := audit.Open()
+	if err == nil {
+		_, err = journal.Append(entry)
+	}
+
+	if err != nil {
+		output.Error("Failed to record action in audit journal: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// ==========================================================================
+// Command for 'auth status' - show the signed in account & tokens
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/benc-uk/pim-cli/pkg/auth"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Authentication commands",
+	Long:  `Commands to inspect authentication, see also 'login' and 'logout'`,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the signed in account & tokens",
+	Long:  `Show the signed in account, tenant, and the expiry & scopes of the PIM and Graph tokens`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		method := authMethod()
+		if method == "" {
+			method = auth.MethodDefault
+		}
+
+		record, loggedIn, err := auth.LoadRecord()
+		if err != nil {
+			return err
+		}
+
+		output.Printfq("%s\t%s\n", output.Label("Auth method:"), method)
+
+		if loggedIn {
+			output.Printfq("%s\t%s\n", output.Label("Logged in as:"), record.Username)
+			output.Printfq("%s\t%s\n", output.Label("Login tenant:"), record.TenantID)
+		} else {
+			output.Printfq("%s\tNot logged in with 'pim-cli login'\n", output.Label("Logged in as:"))
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		graphToken, err := graphClient.GetToken(ctx)
+		printTokenStatus("Graph token", graphToken, err)
+
+		pimToken, err := pimClient.GetToken(ctx)
+		printTokenStatus("PIM token", pimToken, err)
+
+		return nil
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authStatusCmd)
+}
+
+// printTokenStatus shows the account, expiry & scopes of an access token
+func printTokenStatus(title string, token azcore.AccessToken, err error) {
+	output.Printfq("\n%s\n", output.Heading(title))
+
+	if err != nil {
+		output.Printfq("  %s\n", output.Failure(err.Error()))
+		return
+	}
+
+	claims, err := graph.ParseTokenClaims(token.Token)
+	if err != nil {
+		output.Printfq("  %s\n", output.Failure(err.Error()))
+		return
+	}
+
+	scopes := claims.Scopes
+	if scopes == "" {
+		scopes = strings.Join(claims.Roles, " ")
+	}
+
+	account := claims.UPN
+	if account == "" {
+		account = claims.ObjectID
+	}
+
+	output.Printfq("  %s\t%s\n", output.Label("Account:"), account)
+	output.Printfq("  %s\t%s\n", output.Label("Tenant:"), claims.TenantID)
+	output.Printfq("  %s\t%s %s\n", output.Label("Expires:"),
+		token.ExpiresOn.Local().Format("15:04, Jan 02"), output.Info("("+output.Remaining(token.ExpiresOn)+")"))
+	output.Printfq("  %s\t%s\n", output.Label("Scopes:"), scopes)
+}
@@ -0,0 +1,124 @@
+// ==========================================================================
+// Command for 'cache' - manage the local cache of user & tenant lookups
+// ==========================================================================
+
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/cache"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+// How long each type of lookup is cached for
+const (
+	tenantCacheTTL   = 7 * 24 * time.Hour
+	eligibleCacheTTL = 10 * time.Minute
+)
+
+// Cache keys, these are scoped by tenant & account
+const (
+	tenantCacheKey   = "tenant"
+	eligibleCacheKey = "eligible"
+)
+
+// Unscoped cache key prefix for the last account used with each tenant, so completion can find the
+// account's cached entries without getting a token first
+const lastAccountCacheKey = "last-account-"
+
+var refreshFlag bool
+
+// accountCache is the local cache scoped to the signed in account, nil if not available
+var accountCache *cache.Cache
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cache",
+	Long:  `Manage the local cache of tenant & eligibility lookups`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear the local cache",
+	Long:  `Remove all cached tenant & eligibility lookups, for all accounts`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cache.New()
+		if err != nil {
+			return fmt.Errorf("failed to open cache: %w", err)
+		}
+
+		if err := c.Clear(); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+
+		output.Printfq("Cache cleared\n")
+
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+}
+
+// openAccountCache opens the local cache, scoped by the tenant & account from the token claims.
+// Any failure just leaves the cache disabled, as it's only an optimisation. It's not used with --record or
+// --replay, so every lookup goes through the cassette
+func openAccountCache(claims graph.TokenClaims) {
+	if accountCache != nil || claims.TenantID == "" || claims.ObjectID == "" || usingCassette() {
+		return
+	}
+
+	c, err := cache.New()
+	if err != nil {
+		return
+	}
+
+	scope := claims.TenantID + "-" + claims.ObjectID
+	accountCache = c.Scoped(scope)
+
+	_ = c.Set(lastAccountCacheKey+cmp.Or(currentTenant().ID, "default"), scope, tenantCacheTTL)
+}
+
+// lastAccountGet reads an item cached for the last account used with the selected tenant, without
+// needing a token. Only for completion, where speed matters more than the account being current
+func lastAccountGet(key string, result any) bool {
+	if refreshFlag || usingCassette() {
+		return false
+	}
+
+	c, err := cache.New()
+	if err != nil {
+		return false
+	}
+
+	var scope string
+	if !c.Get(lastAccountCacheKey+cmp.Or(currentTenant().ID, "default"), &scope) {
+		return false
+	}
+
+	return c.Scoped(scope).Get(key, result)
+}
+
+// cacheGet reads an item from the account cache, always a miss when --refresh is set
+func cacheGet(key string, result any) bool {
+	if accountCache == nil || refreshFlag {
+		return false
+	}
+
+	return accountCache.Get(key, result)
+}
+
+// cacheSet writes an item to the account cache, failures are ignored
+func cacheSet(key string, value any, ttl time.Duration) {
+	if accountCache == nil {
+		return
+	}
+
+	_ = accountCache.Set(key, value, ttl)
+}
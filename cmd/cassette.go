@@ -0,0 +1,62 @@
+// ==========================================================================
+// Recording & replaying API traffic with the --record & --replay flags
+// ==========================================================================
+
+package cmd
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/benc-uk/pim-cli/pkg/cassette"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/trace"
+)
+
+var recordFlag string
+var replayFlag string
+
+// player serves recorded responses when replaying, nil otherwise
+var player *cassette.Player
+
+// setupCassette puts a recorder or player in front of the shared HTTP client's transport, tracing still
+// happens first so requests are logged whether they go to the network or the cassette
+func setupCassette() error {
+	transport := httpClient.Transport.(*trace.Transport)
+
+	switch {
+	case recordFlag != "":
+		recorder, err := cassette.NewRecorder(recordFlag, transport.Base)
+		if err != nil {
+			return err
+		}
+
+		transport.Base = recorder
+
+		output.Warn("Recording API requests to %s, secrets are removed and your user & tenant IDs, UPN and email domain are "+
+			"replaced, but group names & IDs, display names and other users' details are kept, check it before sharing", recordFlag)
+
+	case replayFlag != "":
+		p, err := cassette.Load(replayFlag)
+		if err != nil {
+			return err
+		}
+
+		player = p
+		transport.Base = p
+	}
+
+	return nil
+}
+
+// usingCassette returns true when recording or replaying, the local cache is skipped so every lookup is captured
+func usingCassette() bool {
+	return recordFlag != "" || replayFlag != ""
+}
+
+// replayCredential returns the credential of the recorded user when replaying, nil otherwise
+func replayCredential() azcore.TokenCredential {
+	if player == nil {
+		return nil
+	}
+
+	return player.Credential()
+}
@@ -0,0 +1,107 @@
+// ==========================================================================
+// Dynamic shell completion for group & role names
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/benc-uk/pim-cli/pkg/config"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/spf13/cobra"
+)
+
+// completeGroupNames completes the --name flag from the user's eligible groups
+func completeGroupNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	assignments, err := completionEligible()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+
+	for _, assignment := range assignments {
+		name := assignment.Resource.DisplayName
+		if seen[name] || !strings.HasPrefix(strings.ToLower(name), strings.ToLower(toComplete)) {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRoleNames completes the --role flag, limited to roles for the group in --name if given
+func completeRoleNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	assignments, err := completionEligible()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	groupName, _ := cmd.Flags().GetString("name")
+	roles := []string{}
+	seen := map[string]bool{}
+
+	for _, assignment := range assignments {
+		role := assignment.RoleDefinition.DisplayName
+		if groupName != "" && assignment.Resource.DisplayName != groupName {
+			continue
+		}
+
+		if seen[role] || !strings.HasPrefix(strings.ToLower(role), strings.ToLower(toComplete)) {
+			continue
+		}
+
+		seen[role] = true
+		roles = append(roles, role)
+	}
+
+	return roles, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTenants completes the --tenant flag from the tenant aliases in the config file
+func completeTenants(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	conf, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	aliases := []string{}
+
+	for alias := range conf.Tenants {
+		if strings.HasPrefix(alias, toComplete) {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	sort.Strings(aliases)
+
+	return aliases, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionEligible returns the user's eligible assignments, from the local cache when possible.
+// The cache of the last account used is tried first, as getting a token can be slow, e.g. running az
+func completionEligible() ([]pim.RoleAssignment, error) {
+	var assignments []pim.RoleAssignment
+	if lastAccountGet(eligibleCacheKey, &assignments) {
+		return assignments, nil
+	}
+
+	pimClient, graphClient, err := getClients()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := identifyUser(ctx, graphClient); err != nil {
+		return nil, err
+	}
+
+	return getEligible(ctx, pimClient)
+}
@@ -0,0 +1,63 @@
+// ==========================================================================
+// Command for 'deactivate' - end an active group + role before it expires
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/benc-uk/pim-cli/pkg/audit"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var deactivateCmd = &cobra.Command{
+	Use:   "deactivate",
+	Short: "Deactivate an active group & role",
+	Long:  `End your activation of a PIM group with the specified role, before it expires`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		output.Printfq("Deactivating '%s' role for '%s'...\n", output.Highlight(roleFlag), output.Highlight(nameFlag))
+		response, err := pimClient.RequestPIMGroupDeactivation(ctx, user.ID, nameFlag, roleFlag)
+		status := strings.TrimSpace(response.Status.Status + " " + response.Status.SubStatus)
+
+		recordAudit(ctx, graphClient, audit.Entry{
+			Action:    audit.ActionDeactivate,
+			Group:     nameFlag,
+			Role:      roleFlag,
+			Message:   status,
+			RequestID: response.ID,
+		}, err)
+
+		if err != nil {
+			return fmt.Errorf("deactivation failed: %w", err)
+		}
+
+		output.Printfq("%s %s\n", output.Label("Request:"), status)
+
+		return nil
+	},
+}
+
+func init() {
+	deactivateCmd.Flags().StringVarP(&nameFlag, "name", "n", "", "Name of the PIM group to deactivate (required)")
+	deactivateCmd.Flags().StringVarP(&roleFlag, "role", "o", "Member", "Role name to deactivate (e.g., 'Member', 'Owner')")
+
+	_ = deactivateCmd.RegisterFlagCompletionFunc("name", completeGroupNames)
+	_ = deactivateCmd.RegisterFlagCompletionFunc("role", completeRoleNames)
+
+	_ = deactivateCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,407 @@
+// ==========================================================================
+// Command for 'doctor' - diagnose authentication, permission & network problems
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/auth"
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/spf13/cobra"
+)
+
+// Result of a single check
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// Tokens are rejected when the clock is out by more than this, so warn well before
+const (
+	maxClockSkew  = 5 * time.Minute
+	warnClockSkew = time.Minute
+)
+
+// How long to wait for each endpoint when checking connectivity
+const connectTimeout = 10 * time.Second
+
+// checkResult is the outcome of a doctor check, with a hint on how to fix it if it didn't pass
+type checkResult struct {
+	status string
+	detail string
+	hint   string
+}
+
+// doctor holds the state passed between checks, later checks are skipped if what they need failed
+type doctor struct {
+	azCloud     cloud.Cloud
+	method      string
+	backend     string
+	pimClient   pim.Backend
+	graphClient *graph.Client
+	serverTime  time.Time
+	graphToken  bool
+	pimToken    bool
+	user        *graph.User
+	failed      int
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose authentication, permission & connectivity problems",
+	Long: `Run a series of checks on your authentication, tenant, network & the PIM API,
+showing what passed or failed, with hints on how to fix any problems`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		tenant := currentTenant()
+
+		d := &doctor{method: authMethodFor(tenant), backend: backendFor(tenant)}
+		if d.method == "" {
+			d.method = auth.MethodDefault
+		}
+
+		azCloud, err := cloudFor(tenant)
+		if err != nil {
+			return err
+		}
+
+		d.azCloud = azCloud
+
+		output.Printfq("%s\t\t%s\n", output.Label("Tenant:"), valueOr(tenant.ID, "Default for the account"))
+		output.Printfq("%s\t%s\n", output.Label("Auth method:"), d.method)
+		output.Printfq("%s\t\t%s\n\n", output.Label("Backend:"), d.backend)
+
+		d.run("Credential chain", func() checkResult { return d.checkCredentials(tenant.ID) })
+		d.run("Proxy & TLS", func() checkResult { return d.checkNetwork(ctx) })
+		d.run("Clock skew", d.checkClock)
+		d.run("Graph token", func() checkResult { return d.checkGraphToken(ctx) })
+		d.run("PIM token & scope", func() checkResult { return d.checkPIMToken(ctx) })
+		d.run("Graph /me", func() checkResult { return d.checkGraphMe(ctx) })
+		d.run("PIM eligibility query", func() checkResult { return d.checkEligibility(ctx) })
+
+		if d.failed > 0 {
+			return fmt.Errorf("%d check(s) failed", d.failed)
+		}
+
+		output.Printfq("\n%s\n", output.Success("All checks passed"))
+
+		return nil
+	},
+}
+
+// run runs a check and prints the result, with the hint for anything which didn't pass
+func (d *doctor) run(name string, check func() checkResult) {
+	result := check()
+
+	style := map[string]output.Style{
+		checkPass: output.StyleSuccess,
+		checkWarn: output.StyleWarning,
+		checkFail: output.StyleFailure,
+		checkSkip: output.StyleMuted,
+	}[result.status]
+	output.Printfq("[%s] %s", style.Render(result.status), name)
+
+	if result.detail != "" {
+		output.Printfq(": %s", result.detail)
+	}
+
+	output.Printfq("\n")
+
+	if result.hint != "" && result.status != checkPass {
+		output.Printfq("       %s\n", output.Info("Hint: "+result.hint))
+	}
+
+	if result.status == checkFail {
+		d.failed++
+	}
+}
+
+// checkCredentials checks which of the selected authentication methods are available, then creates the clients
+func (d *doctor) checkCredentials(tenantID string) checkResult {
+	available := []string{}
+	lines := []string{}
+
+	for _, s := range auth.CheckMethods(d.method, auth.Options{TenantID: tenantID, Cloud: d.azCloud}) {
+		name := s.Method
+		if s.Parent != "" {
+			name = s.Parent + "/" + s.Method
+		}
+
+		if s.Err != nil {
+			lines = append(lines, fmt.Sprintf("\n         - %s: %v", name, s.Err))
+			continue
+		}
+
+		available = append(available, name)
+	}
+
+	var err error
+
+	if len(available) == 0 {
+		return checkResult{
+			status: checkFail,
+			detail: "no authentication method is available" + strings.Join(lines, ""),
+			hint:   "Sign in with 'az login' or 'pim-cli login', or choose another method with --auth",
+		}
+	}
+
+	// Methods are available, so any failure here is from something else, e.g. the tenant or config
+	d.pimClient, d.graphClient, err = getClients()
+	if err != nil {
+		return checkResult{
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "Check the --tenant, --cloud & --backend flags, and the config file",
+		}
+	}
+
+	return checkResult{status: checkPass, detail: "available: " + strings.Join(available, ", ")}
+}
+
+// checkNetwork connects to each endpoint, reporting the proxy used and any TLS problems
+func (d *doctor) checkNetwork(ctx context.Context) checkResult {
+	endpoints := []struct{ name, url string }{
+		{"login", d.azCloud.AuthorityHost},
+		{"graph", d.azCloud.GraphEndpoint},
+		{"pim", d.azCloud.PIMEndpoint},
+	}
+
+	if certFile := os.Getenv("SSL_CERT_FILE"); certFile != "" {
+		if _, err := os.Stat(certFile); err != nil {
+			return checkResult{
+				status: checkFail,
+				detail: fmt.Sprintf("SSL_CERT_FILE is set, but %v", err),
+				hint:   "Point SSL_CERT_FILE at a PEM file of trusted CA certificates, or unset it",
+			}
+		}
+	}
+
+	details := []string{}
+
+	for _, ep := range endpoints {
+		via, serverTime, err := probeEndpoint(ctx, ep.url)
+		if err != nil {
+			return checkResult{status: checkFail, detail: fmt.Sprintf("%s (%s): %v", ep.name, via, err), hint: networkHint(err, via)}
+		}
+
+		if d.serverTime.IsZero() {
+			d.serverTime = serverTime
+		}
+
+		details = append(details, fmt.Sprintf("%s %s", ep.name, via))
+	}
+
+	return checkResult{status: checkPass, detail: strings.Join(details, ", ")}
+}
+
+// probeEndpoint connects to an endpoint, returning how it was reached and the server's date
+func probeEndpoint(ctx context.Context, url string) (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "direct", time.Time{}, fmt.Errorf("invalid endpoint, check the 'endpoints' config setting: %w", err)
+	}
+
+	via := "direct"
+	if proxy, _ := http.ProxyFromEnvironment(req); proxy != nil {
+		via = "via proxy " + proxy.Host
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return via, time.Time{}, err
+	}
+
+	_ = resp.Body.Close()
+	serverTime, _ := http.ParseTime(resp.Header.Get("Date"))
+
+	return via, serverTime, nil
+}
+
+// networkHint suggests a fix for a connection error, TLS failures are usually due to a TLS inspecting proxy
+func networkHint(err error, via string) string {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return "The server certificate isn't trusted, if your network inspects TLS traffic, " +
+			"set SSL_CERT_FILE to a file including your organisation's root CA"
+	}
+
+	if via != "direct" {
+		return "Check the proxy in HTTPS_PROXY is reachable, or add the endpoint to NO_PROXY"
+	}
+
+	return "Check your network connection & firewall, if you need a proxy set HTTPS_PROXY"
+}
+
+// checkClock compares the local clock with the date returned by the servers
+func (d *doctor) checkClock() checkResult {
+	if d.serverTime.IsZero() {
+		return checkResult{status: checkSkip, detail: "no server time available"}
+	}
+
+	skew := time.Since(d.serverTime).Round(time.Second)
+	detail := fmt.Sprintf("local clock differs from the server by %s", skew.Abs())
+	hint := "Sync your system clock, e.g. enable NTP"
+
+	switch {
+	case skew.Abs() > maxClockSkew:
+		return checkResult{status: checkFail, detail: detail, hint: hint + ", tokens will be rejected"}
+	case skew.Abs() > warnClockSkew:
+		return checkResult{status: checkWarn, detail: detail, hint: hint}
+	}
+
+	return checkResult{status: checkPass, detail: detail}
+}
+
+// checkGraphToken gets a token for Microsoft Graph
+func (d *doctor) checkGraphToken(ctx context.Context) checkResult {
+	if d.graphClient == nil {
+		return checkResult{status: checkSkip, detail: "no credential"}
+	}
+
+	token, err := d.graphClient.GetToken(ctx)
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error(), hint: signInHint(d.method)}
+	}
+
+	d.graphToken = true
+
+	return checkResult{status: checkPass, detail: "expires " + token.ExpiresOn.Local().Format("15:04, Jan 02")}
+}
+
+// checkPIMToken gets a token for the backend's API, and checks it is for a user with the right audience.
+// The Graph backend uses a Graph token, so its audience isn't checked
+func (d *doctor) checkPIMToken(ctx context.Context) checkResult {
+	if d.pimClient == nil {
+		return checkResult{status: checkSkip, detail: "no credential"}
+	}
+
+	token, err := d.pimClient.GetToken(ctx)
+	if err != nil {
+		return checkResult{
+			status: checkFail,
+			detail: err.Error(),
+			hint:   signInHint(d.method) + ", your account may also need consent for the PIM API",
+		}
+	}
+
+	claims, err := graph.ParseTokenClaims(token.Token)
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error()}
+	}
+
+	d.pimToken = true
+
+	if d.backend != pim.BackendGraph && strings.Contains(claims.Audience, "graph") {
+		return checkResult{
+			status: checkFail,
+			detail: "token audience is " + claims.Audience,
+			hint:   "The PIM endpoint looks wrong, check the 'cloud' & 'endpoints' settings",
+		}
+	}
+
+	if claims.AppOnly() {
+		return checkResult{
+			status: checkWarn,
+			detail: "token is for an application, not a user",
+			hint:   "Activating PIM groups needs a user account, not a service principal or managed identity",
+		}
+	}
+
+	return checkResult{status: checkPass, detail: fmt.Sprintf("audience %s, scopes: %s", claims.Audience, claims.Scopes)}
+}
+
+// checkGraphMe looks up the signed in user with Microsoft Graph. Graph /me fails for an application,
+// so for app-only tokens the identity is taken from the token, like whoami
+func (d *doctor) checkGraphMe(ctx context.Context) checkResult {
+	if !d.graphToken {
+		return checkResult{status: checkSkip, detail: "no Graph token"}
+	}
+
+	claims, err := d.graphClient.GetTokenClaims(ctx)
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error()}
+	}
+
+	if claims.AppOnly() {
+		if claims.ObjectID == "" {
+			return checkResult{status: checkFail, detail: "application token has no object ID (oid) claim"}
+		}
+
+		d.user = &graph.User{ID: claims.ObjectID, DisplayName: claims.AppDisplayName}
+
+		return checkResult{status: checkSkip, detail: fmt.Sprintf("application token, using object ID %s in tenant %s", claims.ObjectID, claims.TenantID)}
+	}
+
+	u, err := graph.GetCurrentUser(ctx, d.graphClient)
+	if err != nil {
+		return checkResult{
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "Make sure you are signed in as a user, and your organisation allows 'User.Read' for the Azure CLI",
+		}
+	}
+
+	d.user = &u
+
+	return checkResult{status: checkPass, detail: fmt.Sprintf("%s (%s)", u.DisplayName, u.UserPrincipalName)}
+}
+
+// checkEligibility queries the PIM API for the user's eligible groups
+func (d *doctor) checkEligibility(ctx context.Context) checkResult {
+	if !d.pimToken || d.user == nil {
+		return checkResult{status: checkSkip, detail: "no PIM token or user"}
+	}
+
+	eligible, err := d.pimClient.ListEligiblePIMGroups(ctx, d.user.ID)
+	if err != nil {
+		return checkResult{status: checkFail, detail: err.Error(), hint: "The PIM API rejected the query, check the tenant is correct"}
+	}
+
+	if len(eligible) == 0 {
+		return checkResult{
+			status: checkWarn,
+			detail: "query worked, but you have no eligible groups",
+			hint:   "Check you are using the right tenant with --tenant, and ask an admin to make you eligible",
+		}
+	}
+
+	return checkResult{status: checkPass, detail: fmt.Sprintf("%d eligible assignment(s)", len(eligible))}
+}
+
+// signInHint suggests how to sign in again for the authentication method in use
+func signInHint(method string) string {
+	switch {
+	case strings.Contains(method, auth.MethodAzureCLI):
+		return "Run 'az login', with '--tenant' if you use several tenants"
+	case strings.Contains(method, auth.MethodLogin) || auth.IsLoggedIn():
+		return "Run 'pim-cli login' to sign in again"
+	}
+
+	return "Run 'az login' or 'pim-cli login', or choose another method with --auth"
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,72 @@
+// ==========================================================================
+// Exit codes for each class of error, so scripts can react to failures
+// ==========================================================================
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+)
+
+// Exit codes, these are documented in the README so must not change
+const (
+	exitOK               = 0
+	exitError            = 1
+	exitPolicyViolation  = 2
+	exitApprovalRequired = 3
+	exitMfaRequired      = 4
+	exitNotEligible      = 5
+	exitThrottled        = 6
+	exitAuthFailed       = 7
+	exitAlreadyPending   = 8
+	exitNotActive        = 9
+)
+
+// exitCode returns the exit code for the class of an error
+func exitCode(err error) int {
+	var authErr *azidentity.AuthenticationFailedError
+
+	switch {
+	case err == nil, errors.Is(err, pim.ErrAlreadyActive):
+		return exitOK
+	case errors.Is(err, pim.ErrPolicyViolation):
+		return exitPolicyViolation
+	case errors.Is(err, pim.ErrApprovalRequired):
+		return exitApprovalRequired
+	case errors.Is(err, pim.ErrMfaRequired):
+		return exitMfaRequired
+	case errors.Is(err, pim.ErrNotEligible):
+		return exitNotEligible
+	case errors.Is(err, pim.ErrThrottled):
+		return exitThrottled
+	case errors.Is(err, pim.ErrUnauthorized), errors.Is(err, errAuthFailed), errors.As(err, &authErr):
+		return exitAuthFailed
+	case errors.Is(err, pim.ErrAlreadyPending):
+		return exitAlreadyPending
+	case errors.Is(err, pim.ErrNotActive):
+		return exitNotActive
+	}
+
+	return exitError
+}
+
+// errAuthFailed is wrapped around any failure to create a credential or sign in
+var errAuthFailed = errors.New("authentication failed")
+
+// authFailed wraps err so it's reported as an authentication failure
+func authFailed(err error) error {
+	return fmt.Errorf("%w: %w", errAuthFailed, err)
+}
+
+// reportedError is returned by commands which have already told the user what happened,
+// so Execute only needs to exit with the code for the class of the wrapped error
+type reportedError struct {
+	err error
+}
+
+func (e reportedError) Error() string { return e.err.Error() }
+func (e reportedError) Unwrap() error { return e.err }
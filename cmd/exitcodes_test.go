@@ -0,0 +1,207 @@
+// ==========================================================================
+// Tests for the exit codes of commands, run offline by recording cassettes
+// against the fake server in the pimtest package, then replaying them
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/cassette"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/benc-uk/pim-cli/pkg/pimtest"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{pim.ErrAlreadyActive, exitOK},
+		{errors.New("something else"), exitError},
+		{pim.ErrPolicyViolation, exitPolicyViolation},
+		{pim.ErrApprovalRequired, exitApprovalRequired},
+		{pim.ErrMfaRequired, exitMfaRequired},
+		{pim.ErrNotEligible, exitNotEligible},
+		{pim.ErrThrottled, exitThrottled},
+		{pim.ErrUnauthorized, exitAuthFailed},
+		{authFailed(errors.New("no credential")), exitAuthFailed},
+		{pim.ErrAlreadyPending, exitAlreadyPending},
+		{pim.ErrNotActive, exitNotActive},
+		{fmt.Errorf("activation failed: %w", &pim.PimError{Kind: pim.ErrThrottled}), exitThrottled},
+		{reportedError{pim.ErrApprovalRequired}, exitApprovalRequired},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v): expected %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	// Activating Admins (Member), as the request command does
+	activate := func(ctx context.Context, s *pimtest.Server, b pim.Backend) {
+		_, _ = b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "test", time.Hour, "Member")
+	}
+
+	tests := []struct {
+		name  string
+		setup func(ctx context.Context, s *pimtest.Server, b pim.Backend)
+		run   func(ctx context.Context, s *pimtest.Server, b pim.Backend)
+		args  []string
+		want  int
+	}{
+		{
+			name:  "activated",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {},
+			run:   activate,
+			args:  []string{"request", "-n", "Admins", "-r", "test", "-d", "1h"},
+			want:  exitOK,
+		},
+		{
+			name:  "already active",
+			setup: activate,
+			run:   activate,
+			args:  []string{"request", "-n", "Admins", "-r", "test", "-d", "1h"},
+			want:  exitOK,
+		},
+		{
+			name:  "approval required",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) { s.RequireApproval("Admins", true) },
+			run:   activate,
+			args:  []string{"request", "-n", "Admins", "-r", "test", "-d", "1h"},
+			want:  exitApprovalRequired,
+		},
+		{
+			name: "already pending",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {
+				s.RequireApproval("Admins", true)
+				activate(ctx, s, b)
+			},
+			run:  activate,
+			args: []string{"request", "-n", "Admins", "-r", "test", "-d", "1h"},
+			want: exitAlreadyPending,
+		},
+		{
+			name:  "not eligible",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {},
+			run: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {
+				_, _ = b.RequestPIMGroupActivation(ctx, s.User.ID, "Readers", "test", time.Hour, "Member")
+			},
+			args: []string{"request", "-n", "Readers", "-r", "test", "-d", "1h"},
+			want: exitNotEligible,
+		},
+		{
+			name: "throttled",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {
+				s.Inject(pimtest.Throttle("roleAssignmentRequests"))
+			},
+			run:  activate,
+			args: []string{"request", "-n", "Admins", "-r", "test", "-d", "1h"},
+			want: exitThrottled,
+		},
+		{
+			name:  "deactivate when not active",
+			setup: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {},
+			run: func(ctx context.Context, s *pimtest.Server, b pim.Backend) {
+				_, _ = b.RequestPIMGroupDeactivation(ctx, s.User.ID, "Admins", "Member")
+			},
+			args: []string{"deactivate", "-n", "Admins"},
+			want: exitNotActive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := isolate(t)
+			dir := record(t, tt.setup, tt.run)
+
+			if got := execute(append(tt.args, "--replay", dir)...); got != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, got)
+			}
+
+			// Replayed actions never happened, so mustn't be in the audit journal
+			if files, _ := filepath.Glob(filepath.Join(dataDir, "pim-cli", "*")); len(files) > 0 {
+				t.Errorf("expected nothing written to the audit journal when replaying, found %v", files)
+			}
+		})
+	}
+}
+
+// isolate points the config, cache & data directories at an empty temporary directory, returning the data directory
+func isolate(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("PIM_CLI_CONFIG", filepath.Join(dir, "config.json"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("HOME", dir)
+
+	return filepath.Join(dir, "data")
+}
+
+// record sets up a fake server, then records a cassette of the lookups every command makes, followed by run.
+// The user is eligible for Admins (Member)
+func record(t *testing.T, setup, run func(ctx context.Context, s *pimtest.Server, b pim.Backend)) string {
+	t.Helper()
+
+	ctx := context.Background()
+	s := pimtest.NewServer()
+	t.Cleanup(s.Close)
+
+	s.AddEligible("Admins", "Member", time.Time{})
+	setup(ctx, s, pim.NewClient(s.Credential(), &pim.ClientOptions{Cloud: s.Cloud()}))
+
+	dir := filepath.Join(t.TempDir(), "cassette")
+
+	recorder, err := cassette.NewRecorder(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: recorder}
+	graphClient := graph.NewClient(s.Credential(), &graph.ClientOptions{Cloud: s.Cloud(), HTTPClient: client})
+	pimClient := pim.NewClient(s.Credential(), &pim.ClientOptions{Cloud: s.Cloud(), HTTPClient: client})
+
+	if _, err := graph.GetTenantInfo(ctx, graphClient); err != nil {
+		t.Fatal(err)
+	}
+
+	// For the expiry warning
+	if _, err := pimClient.ListEligiblePIMGroups(ctx, s.User.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	run(ctx, s, pimClient)
+
+	return dir
+}
+
+// execute runs the CLI with the given arguments, returning the exit code
+func execute(args ...string) int {
+	rootCmd.SetArgs(args)
+	defer rootCmd.SetArgs(nil)
+
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = devNull
+		defer devNull.Close()
+	}
+
+	return Execute("test")
+}
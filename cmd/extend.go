@@ -0,0 +1,84 @@
+// ==========================================================================
+// Command for 'extend' - extend an active group + role
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/audit"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/spf13/cobra"
+)
+
+// Separate from durationFlag, as the defaults differ
+var extendDurationFlag time.Duration
+
+var extendCmd = &cobra.Command{
+	Use:   "extend",
+	Short: "Extend an active group & role",
+	Long:  `Extend your activation of a PIM group with the specified role, so it ends after the duration from now`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		output.Printfq("Extending '%s' role for '%s'...\n", output.Highlight(roleFlag), output.Highlight(nameFlag))
+		response, err := pimClient.RequestPIMGroupExtension(ctx, user.ID, nameFlag, reasonFlag, extendDurationFlag, roleFlag)
+		status := strings.TrimSpace(response.Status.Status + " " + response.Status.SubStatus)
+
+		// Waiting for approval isn't a failure, the request was made
+		auditErr := err
+		if errors.Is(err, pim.ErrApprovalRequired) {
+			auditErr = nil
+		}
+
+		recordAudit(ctx, graphClient, audit.Entry{
+			Action:    audit.ActionExtend,
+			Group:     nameFlag,
+			Role:      roleFlag,
+			Duration:  extendDurationFlag.String(),
+			Reason:    reasonFlag,
+			Message:   status,
+			RequestID: response.ID,
+		}, auditErr)
+
+		switch {
+		case errors.Is(err, pim.ErrApprovalRequired):
+			output.Printfq("%s %s, waiting for approval\n", output.Label("Request:"), status)
+
+			return reportedError{err}
+		case err != nil:
+			return fmt.Errorf("extension failed: %w", err)
+		}
+
+		output.Printfq("%s %s\n", output.Label("Request:"), status)
+
+		return nil
+	},
+}
+
+func init() {
+	extendCmd.Flags().StringVarP(&nameFlag, "name", "n", "", "Name of the PIM group to extend (required)")
+	extendCmd.Flags().StringVarP(&reasonFlag, "reason", "r", "", "Reason for the extension")
+	extendCmd.Flags().StringVarP(&roleFlag, "role", "o", "Member", "Role name to extend (e.g., 'Member', 'Owner')")
+	extendCmd.Flags().DurationVarP(&extendDurationFlag, "duration", "d", time.Hour, "How long from now the activation should end (e.g., 30m, 1h, 2h)")
+
+	_ = extendCmd.RegisterFlagCompletionFunc("name", completeGroupNames)
+	_ = extendCmd.RegisterFlagCompletionFunc("role", completeRoleNames)
+
+	_ = extendCmd.MarkFlagRequired("name")
+}
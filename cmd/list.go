@@ -7,11 +7,10 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/benc-uk/pim-cli/pkg/output"
-	"github.com/benc-uk/pim-cli/pkg/pim"
 	"github.com/rodaine/table"
 	"github.com/spf13/cobra"
 )
@@ -20,6 +19,7 @@ import (
 type roleInfo struct {
 	role       string
 	memberType string
+	end        time.Time
 }
 
 // groupInfo holds condensed information about a group with multiple roles
@@ -32,23 +32,30 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List eligible groups",
 	Long:  `List all eligible groups for the current user`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cred, graphClient, err := getCredentials()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pimClient, graphClient, err := getClients()
 		if err != nil {
-			log.Fatalf("Authentication failed: %v", err)
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
 		}
 
-		getUserTenantInfo(graphClient)
 		ctx := context.Background()
 
-		assignments, err := pim.ListEligiblePIMGroups(ctx, cred, user.ID)
+		assignments, err := getEligible(ctx, pimClient)
 		if err != nil {
-			output.Fatalf("Failed to list eligible PIM groups: %v", err)
+			return fmt.Errorf("failed to list eligible PIM groups: %w", err)
+		}
+
+		if output.UsingTemplate() {
+			return output.Render(assignments)
 		}
 
 		if len(assignments) == 0 {
 			output.Printfq("No eligible PIM groups found\n")
-			return
+			return nil
 		}
 
 		// Condense assignments by group name
@@ -71,10 +78,7 @@ var listCmd = &cobra.Command{
 
 		var tbl table.Table
 		if quietMode {
-			tbl = table.New("Group Name", "Roles")
-			tbl.WithHeaderFormatter(func(format string, a ...interface{}) string {
-				return fmt.Sprintf("\033[33m"+format+"\033[0m", a...) // Bold
-			})
+			tbl = output.NewTable("Group Name", "Roles", "Eligibility Ends")
 		}
 
 		for _, name := range groupOrder {
@@ -82,16 +86,26 @@ var listCmd = &cobra.Command{
 
 			if quietMode {
 				roleNames := make([]string, len(info.roles))
+				roleEnds := make([]string, len(info.roles))
 				for i, r := range info.roles {
 					roleNames[i] = r.role
+					roleEnds[i] = eligibilityEnd(r.end)
 				}
-				tbl.AddRow(info.name, strings.Join(roleNames, ", "))
+				tbl.AddRow(info.name, strings.Join(roleNames, ", "), strings.Join(roleEnds, ", "))
 				continue
 			}
 
-			output.Printf("\033[33m%s\033[0m\n", info.name)
+			output.Printf("%s\n", output.Heading(info.name))
 			for _, r := range info.roles {
-				output.Printf("  \033[34mRole:\033[0m\t\t%s (%s)\n", r.role, r.memberType)
+				output.Printf("  %s\t\t%s (%s)\n", output.Label("Role:"), r.role, r.memberType)
+
+				// Highlight eligibility which is ending soon
+				endStyle := output.StyleInfo
+				if window := cfg.ExpiryWarning(); window > 0 && !r.end.IsZero() && time.Until(r.end) <= window {
+					endStyle = output.StyleFailure
+				}
+
+				output.Printf("  %s\t%s\n", output.Label("Expires:"), endStyle.Render(eligibilityEnd(r.end)))
 			}
 			output.Println()
 		}
@@ -99,5 +113,16 @@ var listCmd = &cobra.Command{
 		if quietMode {
 			tbl.Print()
 		}
+
+		return nil
 	},
 }
+
+// eligibilityEnd formats the end of an eligibility with the time left, permanent eligibility never ends
+func eligibilityEnd(end time.Time) string {
+	if end.IsZero() {
+		return "Permanent"
+	}
+
+	return fmt.Sprintf("%s (%s)", end.Local().Format("Jan 02 2006"), timeUntil(end))
+}
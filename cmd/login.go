@@ -0,0 +1,59 @@
+// ==========================================================================
+// Commands for 'login' & 'logout' - persistent sign in without the Azure CLI
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benc-uk/pim-cli/pkg/auth"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var deviceCodeFlag bool
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Sign in and keep the session",
+	Long: `Sign in interactively with the browser or a device code, the session is kept in a persistent token cache
+and used by later commands, so you don't need the Azure CLI`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tenant := currentTenant()
+
+		azCloud, err := cloudFor(tenant)
+		if err != nil {
+			return err
+		}
+
+		record, err := auth.Login(context.Background(), deviceCodeFlag, auth.Options{TenantID: tenant.ID, Cloud: azCloud})
+		if err != nil {
+			return fmt.Errorf("login failed: %w", err)
+		}
+
+		output.Printfq("Logged in as %s (tenant %s)\n", output.Highlight(record.Username), record.TenantID)
+
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Sign out and remove the saved session",
+	Long:  `Remove the saved login session and persistent token cache created by 'pim-cli login'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := auth.Logout(); err != nil {
+			return fmt.Errorf("logout failed: %w", err)
+		}
+
+		output.Printfq("Logged out\n")
+
+		return nil
+	},
+}
+
+func init() {
+	loginCmd.Flags().BoolVar(&deviceCodeFlag, "device-code", false, "Sign in with a device code rather than the browser")
+}
@@ -7,7 +7,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/benc-uk/pim-cli/pkg/output"
 	"github.com/benc-uk/pim-cli/pkg/pim"
@@ -16,63 +15,67 @@ import (
 )
 
 var pendingCmd = &cobra.Command{
-	Use:     "pending",
-	Short:   "List pending requests",
-	Aliases: []string{"status"},
-	Long:    `List all pending PIM group + role activation requests for the current user`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cred, graphClient, err := getCredentials()
+	Use:   "pending",
+	Short: "List pending requests",
+	Long:  `List all pending PIM group + role activation requests for the current user`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pimClient, graphClient, err := getClients()
 		if err != nil {
-			log.Fatalf("Authentication failed: %v", err)
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
 		}
 
-		getUserTenantInfo(graphClient)
 		ctx := context.Background()
 
-		pendingAssignments, err := pim.ListPendingPIMRequests(ctx, cred, user.ID)
+		pendingAssignments, err := pimClient.ListPendingPIMRequests(ctx, user.ID)
 		if err != nil {
-			output.Fatalf("Failed to list pending requests: %v\n", err)
+			return fmt.Errorf("failed to list pending requests: %w", err)
 		}
 
-		if len(pendingAssignments) == 0 {
-			output.Printfq("No pending requests found\n")
-			return
+		if output.UsingTemplate() {
+			return output.Render(pendingAssignments)
 		}
 
-		output.Printf("Found %d pending request(s):\n\n", len(pendingAssignments))
+		printPending(pendingAssignments)
 
-		var tbl table.Table
-		if quietMode {
-			tbl = table.New("Group Name", "Role", "Requested At", "Status")
-			tbl.WithHeaderFormatter(func(format string, a ...interface{}) string {
-				return fmt.Sprintf("\033[33m"+format+"\033[0m", a...) // Bold
-			})
-		}
+		return nil
+	},
+}
 
-		for _, assignment := range pendingAssignments {
-			requestedAtNice := assignment.RequestedDateTime.Format("15:04, Jan 02")
-
-			// The API returns status as a mix of types, so we need to assert it down to something useful
-			status := "Unknown"
-			if assignment.Status != nil {
-				if statusMap, ok := assignment.Status.(map[string]interface{}); ok {
-					status = fmt.Sprintf("%s %s", statusMap["status"], statusMap["subStatus"])
-				}
-			}
-
-			if quietMode {
-				tbl.AddRow(assignment.Resource.DisplayName, assignment.RoleDefinition.DisplayName, requestedAtNice, status)
-				continue
-			}
-
-			output.Printf("\033[33m%s\033[0m\n", assignment.Resource.DisplayName)
-			output.Printf("  \033[34mRole:\033[0m\t\t%s\n", assignment.RoleDefinition.DisplayName)
-			output.Printf("  \033[34mRequested At:\033[0m\t%s\n", requestedAtNice)
-			output.Printf("  \033[34mStatus:\033[0m\t%s\n\n", status)
-		}
+// printPending outputs the list of pending requests, as a table in quiet mode
+func printPending(assignments []pim.RoleAssignment) {
+	if len(assignments) == 0 {
+		output.Printfq("No pending requests found\n")
+		return
+	}
+
+	output.Printf("Found %d pending request(s):\n\n", len(assignments))
+
+	var tbl table.Table
+	if quietMode {
+		tbl = output.NewTable("Group Name", "Role", "Requested At", "Status")
+	}
+
+	for _, assignment := range assignments {
+		requestedAtNice := assignment.RequestedDateTime.Format("15:04, Jan 02")
+
+		status := assignment.StatusText()
 
 		if quietMode {
-			tbl.Print()
+			tbl.AddRow(assignment.Resource.DisplayName, assignment.RoleDefinition.DisplayName, requestedAtNice, status)
+			continue
 		}
-	},
+
+		output.Printf("%s\n", output.Heading(assignment.Resource.DisplayName))
+		output.Printf("  %s\t\t%s\n", output.Label("Role:"), assignment.RoleDefinition.DisplayName)
+		output.Printf("  %s\t%s\n", output.Label("Requested At:"), requestedAtNice)
+		output.Printf("  %s\t%s\n\n", output.Label("Status:"), status)
+	}
+
+	if quietMode {
+		tbl.Print()
+	}
 }
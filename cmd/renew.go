@@ -0,0 +1,126 @@
+// ==========================================================================
+// Command for 'renew' - request an extension or renewal of an eligibility
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/audit"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/spf13/cobra"
+)
+
+var renewDaysFlag int
+
+// Only warn about expiring eligibility once per run, as some commands fetch the user info more than once
+var expiryChecked bool
+
+var renewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Request an extension of an eligibility",
+	Long: `Request that your eligibility for a group & role is extended before it ends, or renewed if it has
+already expired. These requests must be approved by an administrator`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if renewDaysFlag <= 0 {
+			return errors.New("--days must be greater than zero")
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		duration := time.Duration(renewDaysFlag) * 24 * time.Hour
+
+		output.Printfq("Requesting renewal of '%s' role for '%s'...\n", output.Highlight(roleFlag), output.Highlight(nameFlag))
+		response, err := pimClient.RequestEligibilityRenewal(ctx, user.ID, nameFlag, reasonFlag, duration, roleFlag)
+		status := strings.TrimSpace(response.Status.Status + " " + response.Status.SubStatus)
+
+		recordAudit(ctx, graphClient, audit.Entry{
+			Action:    audit.ActionRenew,
+			Group:     nameFlag,
+			Role:      roleFlag,
+			Duration:  fmt.Sprintf("%dd", renewDaysFlag),
+			Reason:    reasonFlag,
+			Message:   status,
+			RequestID: response.ID,
+		}, err)
+
+		if err != nil {
+			return fmt.Errorf("renewal request failed: %w", err)
+		}
+
+		output.Printfq("%s %s\n", output.Label("Request:"), status)
+
+		return nil
+	},
+}
+
+func init() {
+	renewCmd.Flags().StringVarP(&nameFlag, "name", "n", "", "Name of the PIM group to renew eligibility for (required)")
+	renewCmd.Flags().StringVarP(&reasonFlag, "reason", "r", "", "Reason for requesting renewal (required)")
+	renewCmd.Flags().StringVarP(&roleFlag, "role", "o", "Member", "Role name to renew (e.g., 'Member', 'Owner')")
+	renewCmd.Flags().IntVar(&renewDaysFlag, "days", 180, "Number of days to extend the eligibility for")
+
+	_ = renewCmd.RegisterFlagCompletionFunc("name", completeGroupNames)
+	_ = renewCmd.RegisterFlagCompletionFunc("role", completeRoleNames)
+
+	_ = renewCmd.MarkFlagRequired("name")
+	_ = renewCmd.MarkFlagRequired("reason")
+}
+
+// warnExpiringEligibility warns about any of the eligible assignments ending within the configured window
+func warnExpiringEligibility(assignments []pim.RoleAssignment) {
+	if expiryChecked {
+		return
+	}
+
+	expiryChecked = true
+
+	for _, a := range expiringSoon(assignments) {
+		output.Warn("Eligibility for '%s' (%s) ends %s, in %s. Run 'pim-cli renew --name \"%s\" --role %s' to extend it",
+			a.Resource.DisplayName, a.RoleDefinition.DisplayName, a.EndDateTime.Local().Format("Jan 02 2006"),
+			timeUntil(a.EndDateTime), a.Resource.DisplayName, a.RoleDefinition.DisplayName)
+	}
+}
+
+// expiringSoon returns the assignments ending within the configured window, none if the warning is turned off
+func expiringSoon(assignments []pim.RoleAssignment) []pim.RoleAssignment {
+	window := cfg.ExpiryWarning()
+	if window == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	expiring := []pim.RoleAssignment{}
+
+	for _, a := range assignments {
+		if a.ExpiresWithin(window, now) {
+			expiring = append(expiring, a)
+		}
+	}
+
+	return expiring
+}
+
+// timeUntil formats the time left until t in days, or hours & minutes when less than a day
+func timeUntil(t time.Time) string {
+	left := time.Until(t)
+	if left < 24*time.Hour {
+		return output.Remaining(t)
+	}
+
+	return fmt.Sprintf("%d days", int(left.Hours()/24))
+}
@@ -0,0 +1,115 @@
+// ==========================================================================
+// Command for 'report' - compliance report of activations over a period
+// ==========================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+const reportDateLayout = "2006-01-02"
+
+var reportFromFlag string
+var reportToFlag string
+var reportFormatFlag string
+var reportOutFlag string
+
+var reportCmd = &cobra.Command{
+	Use:         "report",
+	Short:       "Compliance report of your activations",
+	Long:        `Report on all your PIM requests over a period, with a per-group summary and a detailed listing, e.g. for access reviews`,
+	Annotations: map[string]string{rawOutputAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := time.ParseInLocation(reportDateLayout, reportFromFlag, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid --from date, must be YYYY-MM-DD: %w", err)
+		}
+
+		to, err := time.ParseInLocation(reportDateLayout, reportToFlag, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid --to date, must be YYYY-MM-DD: %w", err)
+		}
+
+		// The to date is inclusive, so run to the end of that day
+		to = to.Add(24*time.Hour - time.Nanosecond)
+		if to.Before(from) {
+			return errors.New("the --to date must not be before the --from date")
+		}
+
+		format := strings.ToLower(reportFormatFlag)
+		if !slices.Contains(report.Formats, format) {
+			return fmt.Errorf("invalid --format, must be one of: %s", strings.Join(report.Formats, ", "))
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		// The tenant name isn't fetched in quiet mode, but is needed in the report
+		if tenantName == "" {
+			if tenantName, err = graph.GetTenantInfo(ctx, graphClient); err != nil {
+				return fmt.Errorf("failed to get tenant info: %w", err)
+			}
+		}
+
+		requests, err := pimClient.ListRequestHistory(ctx, user.ID, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to get request history: %w", err)
+		}
+
+		rep := report.Build(user.UserPrincipalName, tenantName, from, to, requests)
+
+		var w io.Writer = os.Stdout
+
+		if reportOutFlag != "" {
+			f, err := os.Create(reportOutFlag)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer f.Close()
+
+			w = f
+		}
+
+		if err := rep.Write(w, format); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+
+		if reportOutFlag != "" {
+			output.Printfq("Report of %d request(s) written to %s\n", len(rep.Requests), reportOutFlag)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	now := time.Now()
+
+	reportCmd.Flags().StringVar(&reportFromFlag, "from", now.AddDate(0, -3, 0).Format(reportDateLayout), "Start date of the report (YYYY-MM-DD)")
+	reportCmd.Flags().StringVar(&reportToFlag, "to", now.Format(reportDateLayout), "End date of the report, inclusive (YYYY-MM-DD)")
+	reportCmd.Flags().StringVarP(&reportFormatFlag, "format", "f", report.FormatCSV, "Report format: "+strings.Join(report.Formats, "|"))
+	reportCmd.Flags().StringVar(&reportOutFlag, "out", "", "File to write the report to, default is stdout")
+
+	_ = reportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(report.Formats, cobra.ShellCompDirectiveNoFileComp))
+}
@@ -6,9 +6,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/benc-uk/pim-cli/pkg/audit"
 	"github.com/benc-uk/pim-cli/pkg/output"
 	"github.com/benc-uk/pim-cli/pkg/pim"
 	"github.com/spf13/cobra"
@@ -24,37 +27,59 @@ var requestCmd = &cobra.Command{
 	Short:   "Request activation for a group & role",
 	Aliases: []string{"activate"},
 	Long:    `Request activation for an eligible PIM group with the specified role for the current user`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cred, graphClient, err := getCredentials()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pimClient, graphClient, err := getClients()
 		if err != nil {
-			output.Fatalf("Authentication failed: %v\n", err)
+			return err
+		}
+
+		if err := getUserTenantInfo(pimClient, graphClient); err != nil {
+			return err
 		}
 
-		getUserTenantInfo(graphClient)
 		ctx := context.Background()
 
-		output.Printfq("Requesting '\033[1;32m%s\033[0m' role for '\033[1;32m%s\033[0m'...\n", roleFlag, nameFlag)
-		response, err := pim.RequestPIMGroupActivation(ctx, cred, user.ID, nameFlag, reasonFlag, durationFlag, roleFlag)
+		output.Printfq("Requesting '%s' role for '%s'...\n", output.Highlight(roleFlag), output.Highlight(nameFlag))
+		response, err := pimClient.RequestPIMGroupActivation(ctx, user.ID, nameFlag, reasonFlag, durationFlag, roleFlag)
 		status := strings.TrimSpace(response.Status.Status)
-		if err != nil {
-			// Check for http 400, and don't treat as fatal, as it's likely a role already active, which is cool
-			if pimErr, ok := err.(*pim.PimError); ok {
-				if pimErr.HTTPStatusCode == 400 {
-					status = pimErr.ApiError.Message
-				} else {
-					output.Fatalf("Activation failed: %v\n", err)
-				}
-			} else {
-				output.Fatalf("%v\n", err)
-			}
+
+		// Waiting for approval isn't a failure, the request was made
+		auditErr := err
+		if errors.Is(err, pim.ErrApprovalRequired) {
+			auditErr = nil
+		}
+
+		recordAudit(ctx, graphClient, audit.Entry{
+			Action:    audit.ActionRequest,
+			Group:     nameFlag,
+			Role:      roleFlag,
+			Duration:  durationFlag.String(),
+			Reason:    reasonFlag,
+			Message:   strings.TrimSpace(status + " " + response.Status.SubStatus),
+			RequestID: response.ID,
+		}, auditErr)
+
+		switch {
+		case errors.Is(err, pim.ErrAlreadyActive):
+			// Not treated as a failure, as the role being active already is cool
+			output.Printfq("%s Already active, %v\n", output.Label("Request:"), err)
+			return nil
+		case errors.Is(err, pim.ErrApprovalRequired):
+			output.Printfq("%s %s, waiting for approval\n", output.Label("Request:"), status)
+
+			return reportedError{err}
+		case err != nil:
+			return fmt.Errorf("activation failed: %w", err)
 		}
 
 		if status != "" {
-			output.Printfq("\033[34mRequest:\033[0m %s\n", status)
+			output.Printfq("%s %s\n", output.Label("Request:"), status)
 		} else {
 			// Unexpected response format, print full response, you should not normally see this
 			output.Printfq("Activation request submitted. Response:\n %+v", response)
 		}
+
+		return nil
 	},
 }
 
@@ -64,6 +89,9 @@ func init() {
 	requestCmd.Flags().StringVarP(&roleFlag, "role", "o", "Member", "Role name to activate (e.g., 'Member', 'Owner')")
 	requestCmd.Flags().DurationVarP(&durationFlag, "duration", "d", 12*time.Hour, "Duration for the activation (e.g., 30m, 1h, 2h)")
 
+	_ = requestCmd.RegisterFlagCompletionFunc("name", completeGroupNames)
+	_ = requestCmd.RegisterFlagCompletionFunc("role", completeRoleNames)
+
 	_ = requestCmd.MarkFlagRequired("name")
 	_ = requestCmd.MarkFlagRequired("reason")
 }
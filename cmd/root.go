@@ -5,14 +5,22 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/benc-uk/pim-cli/pkg/auth"
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+	"github.com/benc-uk/pim-cli/pkg/config"
 	"github.com/benc-uk/pim-cli/pkg/graph"
 	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/benc-uk/pim-cli/pkg/trace"
 	"github.com/spf13/cobra"
 )
 
@@ -20,81 +28,433 @@ var user graph.User
 var tenantName string
 var quietMode bool
 var version string
+var templateFlag string
+var templateFileFlag string
+var authFlag string
+var tenantFlag string
+var cloudFlag string
+var backendFlag string
+var verboseFlag int
+var debugFlag bool
+var logFileFlag string
+var colorFlag string
+var cfg config.Config
+
+// httpClient is shared by all the API clients, and traces requests when debugging
+var httpClient = trace.NewClient()
+
+// Commands with this annotation write data to stdout, which mustn't be mixed with the banner
+const rawOutputAnnotation = "rawOutput"
 
 var rootCmd = &cobra.Command{
 	Use:   "pim-cli",
 	Short: "PIM Group Management CLI",
 	Long:  `A command-line tool to manage access to Privileged Identity Management (PIM) groups in Azure`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Set first, so any errors below are styled correctly
+		if err := output.SetColor(colorFlag); err != nil {
+			return err
+		}
+
+		// Flags & args are valid by this point, so any later error isn't a usage problem
+		cmd.SilenceUsage = true
+
+		var err error
+
+		cfg, err = config.Load()
+		if err != nil {
+			return err
+		}
+
 		// This runs after flag parsing, so quietMode is available
-		if quietMode {
+		if templateFlag != "" && templateFileFlag != "" {
+			return errors.New("only one of --template or --template-file can be used")
+		}
+
+		if templateFlag != "" {
+			if err := output.SetTemplate(templateFlag); err != nil {
+				return err
+			}
+		}
+
+		if templateFileFlag != "" {
+			if err := output.SetTemplateFile(templateFileFlag); err != nil {
+				return err
+			}
+		}
+
+		// Template output replaces all the normal output, so go quiet, as do commands writing raw data to stdout
+		if quietMode || output.UsingTemplate() || rawOutput(cmd) {
 			output.SetLevel(output.Quiet)
 		} else {
 			output.SetLevel(output.Normal)
 		}
 
-		output.Printf("\033[35mPIM Group CLI v%s\033[0m\n", version)
+		if err := setupDebug(); err != nil {
+			return err
+		}
+
+		if err := setupCassette(); err != nil {
+			return err
+		}
+
+		// Completion output is parsed by the shell, so must not be polluted with the banner
+		if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd ||
+			(cmd.Parent() != nil && cmd.Parent().Name() == "completion") {
+			return nil
+		}
+
+		output.Printf("%s\n", output.Banner("PIM Group CLI v"+version))
+
+		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
-		// Do Stuff Here
-		_ = cmd.Help()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
 	},
 }
 
-// Execute executes the root command.
-func Execute(ver string) error {
+// Execute executes the root command, reporting any error, and returns the exit code for the process
+func Execute(ver string) int {
 	version = ver
 
-	return rootCmd.Execute()
+	// Errors are reported here, so they're styled consistently & commands can be composed
+	rootCmd.SilenceErrors = true
+
+	err := rootCmd.Execute()
+	if err == nil {
+		return exitOK
+	}
+
+	if !errors.As(err, &reportedError{}) {
+		output.Error("%v", err)
+	}
+
+	return max(exitCode(err), exitError)
 }
 
 func init() {
-	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(activeCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(pendingCmd)
 	rootCmd.AddCommand(requestCmd)
+	rootCmd.AddCommand(extendCmd)
+	rootCmd.AddCommand(deactivateCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(authCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(adviseCmd)
+	rootCmd.AddCommand(renewCmd)
+	rootCmd.AddCommand(whoamiCmd)
+	rootCmd.AddCommand(doctorCmd)
 
 	// Global flags
 	rootCmd.PersistentFlags().BoolVarP(&quietMode, "quiet", "q", false, "Simple output in tabular format")
+	rootCmd.PersistentFlags().BoolVar(&refreshFlag, "refresh", false, "Bypass the local cache and fetch fresh data")
+	rootCmd.PersistentFlags().StringVar(&authFlag, "auth", "",
+		"Authentication method(s) to use, comma separated to try several: "+strings.Join(auth.Methods, "|"))
+
+	rootCmd.PersistentFlags().CountVarP(&verboseFlag, "verbose", "v", "Log HTTP requests to stderr, repeat (-vv) to include headers & bodies")
+	rootCmd.PersistentFlags().BoolVar(&debugFlag, "debug", false, "Log HTTP requests with headers & bodies, same as -vv")
+	rootCmd.PersistentFlags().StringVar(&logFileFlag, "log-file", "", "Write debug logs to this file, rather than stderr")
+	rootCmd.PersistentFlags().StringVar(&tenantFlag, "tenant", "", "Tenant to use, an ID or the alias of a tenant in the config file")
+	rootCmd.PersistentFlags().StringVar(&colorFlag, "color", output.ColorAuto,
+		"When to use colour in the output: "+strings.Join(output.ColorModes, "|")+", NO_COLOR is respected in auto mode")
+	rootCmd.PersistentFlags().StringVar(&cloudFlag, "cloud", "", "Azure cloud to use: "+strings.Join(cloud.Names(), "|"))
+	rootCmd.PersistentFlags().StringVar(&backendFlag, "backend", "", "API used to manage PIM groups: "+strings.Join(pim.Backends, "|"))
+	rootCmd.PersistentFlags().StringVar(&recordFlag, "record", "", "Record API requests & responses to this directory, with secrets removed")
+	rootCmd.PersistentFlags().StringVar(&replayFlag, "replay", "", "Replay API responses recorded with --record, without signing in")
+
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	_ = rootCmd.MarkPersistentFlagDirname("record")
+	_ = rootCmd.MarkPersistentFlagDirname("replay")
+
+	_ = rootCmd.RegisterFlagCompletionFunc("auth", cobra.FixedCompletions(auth.Methods, cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("tenant", completeTenants)
+	_ = rootCmd.RegisterFlagCompletionFunc("color", cobra.FixedCompletions(output.ColorModes, cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("cloud", cobra.FixedCompletions(cloud.Names(), cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("backend", cobra.FixedCompletions(pim.Backends, cobra.ShellCompDirectiveNoFileComp))
+
+	// Template flags only apply to the listing commands
+	for _, c := range []*cobra.Command{listCmd, activeCmd, pendingCmd, statusCmd} {
+		addTemplateFlags(c)
+	}
 }
 
-// getCredentials creates Azure credential and Microsoft Graph client
-func getCredentials() (azcore.TokenCredential, *graph.Client, error) {
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+// setupDebug sets the debug level from the flags, and opens the log file if one is given
+func setupDebug() error {
+	level := min(verboseFlag, output.DebugFull)
+	if debugFlag {
+		level = output.DebugFull
+	}
+
+	// A log file on its own means log everything to it
+	if logFileFlag != "" && level == output.DebugOff {
+		level = output.DebugFull
+	}
+
+	if level == output.DebugOff {
+		return nil
+	}
+
+	if logFileFlag == "" {
+		output.SetDebug(level, nil)
+		return nil
+	}
+
+	// The file is left open until the process exits
+	logFile, err := os.OpenFile(logFileFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create Azure credential: %w", err)
+		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	// Note. getting here does not guarantee that authentication will succeed!
+	output.SetDebug(level, logFile)
 
-	// Create Graph client using HTTP-based implementation
-	graphClient := graph.NewClient(cred)
+	return nil
+}
+
+// rawOutput returns true if the command writes raw data to stdout, either always or when JSON output is asked for
+func rawOutput(cmd *cobra.Command) bool {
+	if cmd.Annotations[rawOutputAnnotation] == "true" {
+		return true
+	}
+
+	flag := cmd.Flags().Lookup("output")
 
-	return cred, graphClient, nil
+	return flag != nil && flag.Value.String() == "json"
 }
 
-// getUserTenantInfo retrieves and displays the current user and tenant information
-func getUserTenantInfo(graphClient *graph.Client) {
-	ctx := context.Background()
+// addTemplateFlags adds the --template & --template-file flags to a command
+func addTemplateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&templateFlag, "template", "", "Go template to format the output, run against the list of assignments")
+	cmd.Flags().StringVar(&templateFileFlag, "template-file", "", "File containing a Go template to format the output")
+}
 
-	// Get current user info, the user details are used in multiple commands
-	var err error
+// getClients creates the Azure credential, then the PIM backend & Microsoft Graph client for the selected tenant
+func getClients() (pim.Backend, *graph.Client, error) {
+	return getTenantClients(currentTenant())
+}
 
-	user, err = graph.GetCurrentUser(ctx, graphClient)
+// getTenantClients creates the Azure credential, then the PIM backend & Microsoft Graph client for the given tenant
+func getTenantClients(tenant config.Tenant) (pim.Backend, *graph.Client, error) {
+	azCloud, err := cloudFor(tenant)
 	if err != nil {
-		log.Fatalf("Failed to get user info: %v", err)
+		return nil, nil, err
+	}
+
+	authOpts := auth.Options{TenantID: tenant.ID, Cloud: azCloud}
+
+	// Replays are for the recorded user, so there's no need to sign in
+	cred := replayCredential()
+	if cred == nil {
+		if cred, err = auth.NewCredential(authMethodFor(tenant), authOpts); err != nil {
+			return nil, nil, authFailed(fmt.Errorf("failed to create Azure credential: %w", err))
+		}
+	}
+
+	// Note. getting here does not guarantee that authentication will succeed!
+
+	// Create PIM & Graph clients using HTTP-based implementation
+	userAgent := "pim-cli/" + version
+
+	graphClient := graph.NewClient(cred, &graph.ClientOptions{Cloud: azCloud, HTTPClient: httpClient, UserAgent: userAgent})
+
+	switch backend := backendFor(tenant); backend {
+	case pim.BackendAzureRBAC:
+		pimClient := pim.NewClient(cred, &pim.ClientOptions{
+			Cloud:           azCloud,
+			HTTPClient:      httpClient,
+			UserAgent:       userAgent,
+			ClaimsChallenge: claimsChallenge(authOpts),
+		})
+
+		return pimClient, graphClient, nil
+	case pim.BackendGraph:
+		return pim.NewGraphBackend(graphClient), graphClient, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown backend '%s', valid backends are: %s", backend, strings.Join(pim.Backends, ", "))
 	}
+}
 
-	if !quietMode {
-		// Get tenant info, micro speed up by only doing this if not quiet mode
-		tenantName, err = graph.GetTenantInfo(ctx, graphClient)
+// claimsChallenge returns a handler for PIM claims challenges, which explains to the user why they need
+// to sign in again, then returns an interactive credential to get a token with the required claims
+func claimsChallenge(authOpts auth.Options) func(claims string) (azcore.TokenCredential, error) {
+	return func(claims string) (azcore.TokenCredential, error) {
+		cred, method, err := auth.NewChallengeCredential(authOpts)
 		if err != nil {
-			log.Fatalf("Failed to get tenant info: %v", err)
+			return nil, err
+		}
+
+		how := "A browser window will open"
+		if method == auth.MethodDeviceCode {
+			how = "Follow the device code instructions below"
 		}
+
+		output.Warn("The PIM policy for this group needs MFA or a Conditional Access authentication context, "+
+			"which your current sign in doesn't satisfy. %s to sign in again, then the request will be retried", how)
+
+		return cred, nil
 	}
+}
+
+// cloudFor returns the endpoints of the Azure cloud for a tenant, the flag takes precedence over
+// the tenant profile, which takes precedence over the config file. Custom endpoints are applied last
+func cloudFor(tenant config.Tenant) (cloud.Cloud, error) {
+	name := cfg.Cloud
+	if tenant.Cloud != "" {
+		name = tenant.Cloud
+	}
+
+	if cloudFlag != "" {
+		name = cloudFlag
+	}
+
+	azCloud, err := cloud.Get(name)
+	if err != nil {
+		return cloud.Cloud{}, err
+	}
+
+	return azCloud.WithOverrides(cfg.Endpoints), nil
+}
+
+// currentTenant returns the selected tenant, the flag takes precedence over the config file.
+// An empty tenant ID means the default tenant for the account
+func currentTenant() config.Tenant {
+	name := tenantFlag
+	if name == "" {
+		name = cfg.Tenant
+	}
+
+	_, tenant := cfg.ResolveTenant(name)
+
+	return tenant
+}
+
+// authMethod returns the selected authentication method(s) for the selected tenant
+func authMethod() string {
+	return authMethodFor(currentTenant())
+}
+
+// authMethodFor returns the authentication method(s) for a tenant,
+// the flag takes precedence over the tenant profile, which takes precedence over the config file
+func authMethodFor(tenant config.Tenant) string {
+	if authFlag != "" {
+		return authFlag
+	}
+
+	if tenant.Auth != "" {
+		return tenant.Auth
+	}
+
+	return cfg.Auth
+}
+
+// backendFor returns the backend used to manage PIM groups for a tenant, the flag takes precedence
+// over the tenant profile, which takes precedence over the config file
+func backendFor(tenant config.Tenant) string {
+	return cmp.Or(backendFlag, tenant.Backend, cfg.Backend, pim.Backends[0])
+}
+
+// identifyUser sets the current user from the claims in the Graph access token, rather than calling
+// Graph /me, which saves a round trip on every command. It also opens the local cache for the account
+func identifyUser(ctx context.Context, graphClient *graph.Client) error {
+	claims, err := graphClient.GetTokenClaims(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	if claims.ObjectID == "" {
+		return fmt.Errorf("failed to get user info: access token has no object ID (oid) claim")
+	}
+
+	user = graph.User{
+		ID:                claims.ObjectID,
+		DisplayName:       claims.Name,
+		UserPrincipalName: cmp.Or(claims.UPN, claims.UniqueName),
+	}
+
+	openAccountCache(claims)
+
+	return nil
+}
+
+// getUserTenantInfo identifies the current user, displays the user and tenant information,
+// then warns about any eligibilities which are about to end
+func getUserTenantInfo(pimClient pim.Backend, graphClient *graph.Client) error {
+	ctx := context.Background()
+
+	if err := identifyUser(ctx, graphClient); err != nil {
+		return err
+	}
+
+	// These lookups don't depend on each other, so are made concurrently
+	var (
+		wg        sync.WaitGroup
+		tenantErr error
+		eligible  []pim.RoleAssignment
+	)
+
+	wg.Go(func() { tenantErr = lookupTenantName(ctx, graphClient) })
+
+	// The expiry warning is only a helpful reminder, so any failure to fetch the eligibilities is ignored
+	if !expiryChecked && cfg.ExpiryWarning() > 0 {
+		wg.Go(func() {
+			eligible, _ = getEligible(ctx, pimClient)
+		})
+	}
+
+	wg.Wait()
+
+	if tenantErr != nil {
+		return tenantErr
+	}
+
+	printUserTenant()
+	warnExpiringEligibility(eligible)
+
+	return nil
+}
+
+// lookupTenantName sets the tenant name, from the local cache when possible.
+// Micro speed up by only doing this if not quiet mode, as that's the only time it's shown
+func lookupTenantName(ctx context.Context, graphClient *graph.Client) error {
+	if quietMode || cacheGet(tenantCacheKey, &tenantName) {
+		return nil
+	}
+
+	name, err := graph.GetTenantInfo(ctx, graphClient)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant info: %w", err)
+	}
+
+	tenantName = name
+	cacheSet(tenantCacheKey, tenantName, tenantCacheTTL)
+
+	return nil
+}
+
+// printUserTenant outputs the tenant & current user, falling back to the UPN or ID when the token has no name
+func printUserTenant() {
+	output.Printf("%s\t\t%s\n", output.Label("Tenant:"), tenantName)
+	output.Printf("%s\t%s\n", output.Label("Current user:"), cmp.Or(user.DisplayName, user.UserPrincipalName, user.ID))
+}
+
+// getEligible returns the user's eligible assignments, from the local cache when possible
+func getEligible(ctx context.Context, pimClient pim.Backend) ([]pim.RoleAssignment, error) {
+	var assignments []pim.RoleAssignment
+	if cacheGet(eligibleCacheKey, &assignments) {
+		return assignments, nil
+	}
+
+	assignments, err := pimClient.ListEligiblePIMGroups(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSet(eligibleCacheKey, assignments, eligibleCacheTTL)
 
-	output.Printf("\033[34mTenant:\033[0m\t\t%s\n", tenantName)
-	output.Printf("\033[34mCurrent user:\033[0m\t%s\n", user.DisplayName)
+	return assignments, nil
 }
@@ -1,19 +1,306 @@
 // ==========================================================================
-// Command for 'status' - list both active & pending group activations
+// Command for 'status' - active & pending activations, and eligibility
+// ending soon, fetched concurrently and shown in one report
 // ==========================================================================
 
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/benc-uk/pim-cli/pkg/config"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/rodaine/table"
 	"github.com/spf13/cobra"
 )
 
+var allTenantsFlag bool
+
+// statusData is passed to output templates for the status command
+type statusData struct {
+	Active   []pim.RoleAssignment
+	Pending  []pim.RoleAssignment
+	Expiring []pim.RoleAssignment
+}
+
+// statusErrors holds the error from fetching each part of the status, so the other parts can still be shown
+type statusErrors struct {
+	active   error
+	pending  error
+	expiring error
+}
+
+// tenantStatus holds the status of one tenant, and is passed to output templates with --all-tenants
+type tenantStatus struct {
+	Alias      string
+	TenantID   string
+	TenantName string
+	Active     []pim.RoleAssignment
+	Pending    []pim.RoleAssignment
+	Expiring   []pim.RoleAssignment
+	Error      error
+}
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
-	Short: "List both active & pending group activations",
-	Long:  `List all active & pending PIM group activations for the current user`,
-	Run: func(cmd *cobra.Command, args []string) {
-		activeCmd.Run(cmd, args)
-		pendingCmd.Run(cmd, args)
+	Short: "Show active & pending activations, and eligibility ending soon",
+	Long: `Show all active & pending PIM group activations for the current user, and any eligibility
+ending soon, in a single report`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if allTenantsFlag {
+			return statusAllTenants()
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		if err := identifyUser(ctx, graphClient); err != nil {
+			return err
+		}
+
+		var (
+			wg        sync.WaitGroup
+			tenantErr error
+			data      statusData
+			errs      statusErrors
+		)
+
+		listEligible := func(ctx context.Context) ([]pim.RoleAssignment, error) { return getEligible(ctx, pimClient) }
+
+		wg.Go(func() { tenantErr = lookupTenantName(ctx, graphClient) })
+		wg.Go(func() { data, errs = fetchStatus(ctx, pimClient, user.ID, listEligible) })
+		wg.Wait()
+
+		if tenantErr != nil {
+			return tenantErr
+		}
+
+		// Eligibility ending soon is part of the report, so there's no need to warn about it too
+		expiryChecked = true
+
+		if output.UsingTemplate() {
+			if err := errs.join(); err != nil {
+				return err
+			}
+
+			return output.Render(data)
+		}
+
+		printUserTenant()
+		printStatus(data, errs)
+
+		// Any errors have been shown in place of that part of the report
+		if err := errs.join(); err != nil {
+			return reportedError{err}
+		}
+
+		return nil
 	},
 }
+
+func init() {
+	statusCmd.Flags().BoolVar(&allTenantsFlag, "all-tenants", false, "Show status for every tenant in the config file")
+}
+
+// fetchStatus gets the active & pending assignments, and the eligibility ending soon, concurrently.
+// Every part is fetched even if another fails, so each has its own error
+func fetchStatus(ctx context.Context, pimClient pim.Backend, userID string,
+	listEligible func(context.Context) ([]pim.RoleAssignment, error)) (statusData, statusErrors) {
+	var (
+		wg   sync.WaitGroup
+		data statusData
+		errs statusErrors
+	)
+
+	wg.Go(func() {
+		if data.Active, errs.active = pimClient.ListActivePIMGroups(ctx, userID); errs.active != nil {
+			errs.active = fmt.Errorf("failed to list active groups: %w", errs.active)
+		}
+	})
+
+	wg.Go(func() {
+		if data.Pending, errs.pending = pimClient.ListPendingPIMRequests(ctx, userID); errs.pending != nil {
+			errs.pending = fmt.Errorf("failed to list pending requests: %w", errs.pending)
+		}
+	})
+
+	// Skipped when the expiry warning is turned off in the config
+	if cfg.ExpiryWarning() > 0 {
+		wg.Go(func() {
+			eligible, err := listEligible(ctx)
+			if err != nil {
+				errs.expiring = fmt.Errorf("failed to list eligible PIM groups: %w", err)
+				return
+			}
+
+			data.Expiring = expiringSoon(eligible)
+		})
+	}
+
+	wg.Wait()
+
+	return data, errs
+}
+
+// join returns all the errors as one, nil if every part was fetched
+func (e statusErrors) join() error {
+	return errors.Join(e.active, e.pending, e.expiring)
+}
+
+// printStatus outputs each part of the status, or the error in its place if it couldn't be fetched
+func printStatus(data statusData, errs statusErrors) {
+	parts := []struct {
+		err   error
+		print func()
+	}{
+		{errs.active, func() { printActive(data.Active) }},
+		{errs.pending, func() { printPending(data.Pending) }},
+		{errs.expiring, func() { printExpiring(data.Expiring) }},
+	}
+
+	for _, part := range parts {
+		if part.err != nil {
+			output.Printfq("%s\n\n", output.Failure("Error: "+part.err.Error()))
+			continue
+		}
+
+		part.print()
+	}
+}
+
+// printExpiring outputs the eligibility ending soon, as a table in quiet mode. Nothing is shown if there's none
+func printExpiring(assignments []pim.RoleAssignment) {
+	if len(assignments) == 0 {
+		return
+	}
+
+	output.Printf("Found %d eligibility(s) ending within %d days:\n\n", len(assignments), int(cfg.ExpiryWarning().Hours()/24))
+
+	var tbl table.Table
+	if quietMode {
+		tbl = output.NewTable("Group Name", "Role", "Eligibility Ends")
+	}
+
+	for _, assignment := range assignments {
+		endsNice := assignment.EndDateTime.Local().Format("Jan 02 2006")
+
+		if quietMode {
+			tbl.AddRow(assignment.Resource.DisplayName, assignment.RoleDefinition.DisplayName, endsNice)
+			continue
+		}
+
+		output.Printf("%s\n", output.Heading(assignment.Resource.DisplayName))
+		output.Printf("  %s\t\t%s\n", output.Label("Role:"), assignment.RoleDefinition.DisplayName)
+		output.Printf("  %s\t\t%s %s\n\n", output.Label("Ends:"), endsNice, output.Warning("(in "+timeUntil(assignment.EndDateTime)+")"))
+	}
+
+	if quietMode {
+		tbl.Print()
+		return
+	}
+
+	output.Printf("Run 'pim-cli renew --name <group> --role <role>' to request an extension\n")
+}
+
+// statusAllTenants queries every configured tenant concurrently, and outputs the results grouped by tenant
+func statusAllTenants() error {
+	if len(cfg.Tenants) == 0 {
+		return errors.New("no tenants configured, add them to the 'tenants' section of the config file")
+	}
+
+	aliases := []string{}
+	for alias := range cfg.Tenants {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	ctx := context.Background()
+	results := make([]tenantStatus, len(aliases))
+
+	var wg sync.WaitGroup
+	for i, alias := range aliases {
+		wg.Go(func() {
+			results[i] = fetchTenantStatus(ctx, alias, cfg.Tenants[alias])
+		})
+	}
+
+	wg.Wait()
+
+	if output.UsingTemplate() {
+		return output.Render(results)
+	}
+
+	failed := 0
+
+	for _, result := range results {
+		output.Printfq("\n%s\n", output.Banner(fmt.Sprintf("=== %s (%s) ===", result.Alias, result.TenantName)))
+
+		if result.Error != nil {
+			failed++
+
+			output.Printfq("%s\n", output.Failure(fmt.Sprintf("Error: %v", result.Error)))
+
+			continue
+		}
+
+		printStatus(statusData{Active: result.Active, Pending: result.Pending, Expiring: result.Expiring}, statusErrors{})
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to get status for %d of %d tenants", failed, len(results))
+	}
+
+	return nil
+}
+
+// fetchTenantStatus gets the status for the user in a tenant, the eligibility isn't cached as the
+// local cache is only for the selected tenant
+func fetchTenantStatus(ctx context.Context, alias string, tenant config.Tenant) tenantStatus {
+	result := tenantStatus{Alias: alias, TenantID: tenant.ID, TenantName: tenant.ID}
+
+	pimClient, graphClient, err := getTenantClients(tenant)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	claims, err := graphClient.GetTokenClaims(ctx)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	listEligible := func(ctx context.Context) ([]pim.RoleAssignment, error) {
+		return pimClient.ListEligiblePIMGroups(ctx, claims.ObjectID)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		data statusData
+		errs statusErrors
+	)
+
+	// The tenant name is only for display, so a failure to get it isn't an error
+	wg.Go(func() {
+		if name, err := graph.GetTenantInfo(ctx, graphClient); err == nil {
+			result.TenantName = name
+		}
+	})
+	wg.Go(func() { data, errs = fetchStatus(ctx, pimClient, claims.ObjectID, listEligible) })
+	wg.Wait()
+
+	result.Active, result.Pending, result.Expiring = data.Active, data.Pending, data.Expiring
+	result.Error = errs.join()
+
+	return result
+}
@@ -0,0 +1,197 @@
+// ==========================================================================
+// Command for 'whoami' - show the signed in identity & a summary of access
+// ==========================================================================
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/benc-uk/pim-cli/pkg/auth"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/spf13/cobra"
+)
+
+var whoamiOutputFlag string
+
+// whoamiInfo is everything shown by whoami, and is the JSON output
+type whoamiInfo struct {
+	User             graph.User `json:"user"`
+	TenantID         string     `json:"tenantId"`
+	TenantName       string     `json:"tenantName"`
+	AuthMethod       string     `json:"authMethod"`
+	TokenAuthMethods []string   `json:"tokenAuthMethods"`
+	AppOnly          bool       `json:"appOnly"`
+	Eligible         int        `json:"eligible"`
+	Active           int        `json:"active"`
+	Pending          int        `json:"pending"`
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the signed in user & a summary of PIM assignments",
+	Long: `Show the signed in user's profile, tenant, how they authenticated, and a count of
+eligible, active & pending PIM assignments. Use '--output json' for scripts & bug reports`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains([]string{"text", "json"}, whoamiOutputFlag) {
+			return fmt.Errorf("unknown output format '%s', must be text or json", whoamiOutputFlag)
+		}
+
+		pimClient, graphClient, err := getClients()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		info := whoamiInfo{AuthMethod: authMethod(), TokenAuthMethods: []string{}}
+
+		if info.AuthMethod == "" {
+			info.AuthMethod = auth.MethodDefault
+		}
+
+		claims, err := graphClient.GetTokenClaims(ctx)
+		if err != nil {
+			return err
+		}
+
+		info.TenantID = claims.TenantID
+		info.AppOnly = claims.AppOnly()
+
+		if claims.AuthMethods != nil {
+			info.TokenAuthMethods = claims.AuthMethods
+		}
+
+		if err := identifyUser(ctx, graphClient); err != nil {
+			return err
+		}
+
+		// All these lookups only need the user ID, so are made concurrently
+		var (
+			wg                        sync.WaitGroup
+			profile                   graph.User
+			eligible, active, pending []pim.RoleAssignment
+			profileErr, eligibleErr   error
+			activeErr, pendingErr     error
+		)
+
+		// Fetch the full profile, as the token only has the name. Graph /me fails for an application,
+		// so for app-only tokens the profile is just what the token has
+		if info.AppOnly {
+			profile = user
+			profile.DisplayName = cmp.Or(claims.Name, claims.AppDisplayName)
+		} else {
+			wg.Go(func() { profile, profileErr = graph.GetCurrentUser(ctx, graphClient) })
+		}
+
+		wg.Go(func() { eligible, eligibleErr = getEligible(ctx, pimClient) })
+		wg.Go(func() { active, activeErr = pimClient.ListActivePIMGroups(ctx, user.ID) })
+		wg.Go(func() { pending, pendingErr = pimClient.ListPendingPIMRequests(ctx, user.ID) })
+
+		if !cacheGet(tenantCacheKey, &tenantName) {
+			wg.Go(func() {
+				if name, err := graph.GetTenantInfo(ctx, graphClient); err == nil {
+					tenantName = name
+					cacheSet(tenantCacheKey, tenantName, tenantCacheTTL)
+				}
+			})
+		}
+
+		wg.Wait()
+
+		switch {
+		case profileErr != nil:
+			return profileErr
+		case eligibleErr != nil:
+			return fmt.Errorf("failed to list eligible PIM groups: %w", eligibleErr)
+		case activeErr != nil:
+			return fmt.Errorf("failed to list active groups: %w", activeErr)
+		case pendingErr != nil:
+			return fmt.Errorf("failed to list pending requests: %w", pendingErr)
+		}
+
+		user = profile
+		info.User = user
+		info.TenantName = tenantName
+
+		warnExpiringEligibility(eligible)
+
+		info.Eligible, info.Active, info.Pending = len(eligible), len(active), len(pending)
+
+		if whoamiOutputFlag == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+
+			return enc.Encode(info)
+		}
+
+		printWhoami(info)
+
+		return nil
+	},
+}
+
+func init() {
+	whoamiCmd.Flags().StringVar(&whoamiOutputFlag, "output", "text", "Output format: text|json")
+
+	_ = whoamiCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// printWhoami outputs the identity details, skipping any profile fields which aren't set
+func printWhoami(info whoamiInfo) {
+	// There's no account status for an application, as the profile comes from the token
+	accountStatus := output.Success("Enabled")
+	if info.AppOnly {
+		accountStatus = "Application"
+	} else if !info.User.AccountEnabled {
+		accountStatus = output.Failure("Disabled")
+	}
+
+	fields := [][2]string{
+		{"Name", info.User.DisplayName},
+		{"UPN", info.User.UserPrincipalName},
+		{"Mail", info.User.Mail},
+		{"Object ID", info.User.ID},
+		{"Job Title", info.User.JobTitle},
+		{"Department", info.User.Department},
+		{"Company", info.User.CompanyName},
+		{"Office", info.User.OfficeLocation},
+		{"Employee ID", info.User.EmployeeID},
+		{"Alias", info.User.Alias},
+		{"Account", accountStatus},
+	}
+
+	output.Printfq("\n%s\n", output.Heading("Identity"))
+
+	for _, f := range fields {
+		if f[1] != "" {
+			output.Printfq("  %s%s\n", output.Label(fmt.Sprintf("%-14s", f[0]+":")), f[1])
+		}
+	}
+
+	tokenMethods := strings.Join(info.TokenAuthMethods, ", ")
+	if tokenMethods == "" {
+		tokenMethods = "Unknown"
+	}
+
+	output.Printfq("\n%s\n", output.Heading("Tenant"))
+	output.Printfq("  %s\t\t%s\n", output.Label("Name:"), info.TenantName)
+	output.Printfq("  %s\t\t%s\n", output.Label("ID:"), info.TenantID)
+
+	output.Printfq("\n%s\n", output.Heading("Authentication"))
+	output.Printfq("  %s\t%s\n", output.Label("Method:"), info.AuthMethod)
+	output.Printfq("  %s\t%s\n", output.Label("Token AMR:"), tokenMethods)
+
+	output.Printfq("\n%s\n", output.Heading("PIM Assignments"))
+	output.Printfq("  %s\t%d\n", output.Label("Eligible:"), info.Eligible)
+	output.Printfq("  %s\t%d\n", output.Label("Active:"), info.Active)
+	output.Printfq("  %s\t%d\n", output.Label("Pending:"), info.Pending)
+}
@@ -5,10 +5,14 @@
 
 package main
 
-import "github.com/benc-uk/pim-cli/cmd"
+import (
+	"os"
+
+	"github.com/benc-uk/pim-cli/cmd"
+)
 
 var version = "0.0.0"
 
 func main() {
-	_ = cmd.Execute(version)
+	os.Exit(cmd.Execute(version))
 }
@@ -0,0 +1,176 @@
+// ==============================================================================================
+// Least privilege advisor, analyses activation history to suggest shorter activation durations
+// and to find eligibilities that are not being used, and so could be given up
+// ===============================================================================================
+
+package advisor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+)
+
+// Options for the analysis
+type Options struct {
+	// UnusedAfter is how long without an activation before an eligibility is flagged as unused
+	UnusedAfter time.Duration
+	// MinActivations is how many activations are needed before suggesting a duration
+	MinActivations int
+	// QuickDeactivation is how soon after activating a deactivation suggests it wasn't needed
+	QuickDeactivation time.Duration
+}
+
+// DefaultOptions are sensible defaults for the analysis
+var DefaultOptions = Options{
+	UnusedAfter:       90 * 24 * time.Hour,
+	MinActivations:    3,
+	QuickDeactivation: 15 * time.Minute,
+}
+
+// Durations are suggested in these steps, and never below one step
+const suggestionStep = 30 * time.Minute
+
+// Advice is the analysis of one eligible group & role
+type Advice struct {
+	Group string
+	Role  string
+	// Activations is how many times the role was activated in the period
+	Activations int
+	// PerWeek is the average number of activations per week
+	PerWeek float64
+	// TypicalRequested is the median requested duration
+	TypicalRequested time.Duration
+	// TypicalActual is the median time the role was actually active for
+	TypicalActual time.Duration
+	// EarlyEnds is how many activations were deactivated before they expired
+	EarlyEnds int
+	// QuickEnds is how many activations were deactivated almost straight away
+	QuickEnds int
+	// Suggested is the suggested default duration, zero if there isn't enough data
+	Suggested time.Duration
+	// LastActivated is when the role was last activated, zero if never in the period
+	LastActivated time.Time
+	// Unused is true when the role hasn't been activated for longer than Options.UnusedAfter
+	Unused bool
+	// NotNeeded is true when most activations were deactivated almost straight away
+	NotNeeded bool
+}
+
+// Analyse produces advice for each eligible group & role, from the activations over the period.
+// Activations from before the period are only used to find when a role was last used, for the unused check
+func Analyse(eligible []pim.RoleAssignment, activations []pim.Activation, period time.Duration, now time.Time, opts Options) []Advice {
+	byKey := map[string][]pim.Activation{}
+
+	for _, a := range activations {
+		key := a.Request.Resource.DisplayName + "\x00" + a.Request.RoleDefinition.DisplayName
+		byKey[key] = append(byKey[key], a)
+	}
+
+	advice := []Advice{}
+	seen := map[string]bool{}
+
+	for _, e := range eligible {
+		key := e.Resource.DisplayName + "\x00" + e.RoleDefinition.DisplayName
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		advice = append(advice, analyseRole(e.Resource.DisplayName, e.RoleDefinition.DisplayName, byKey[key], period, now, opts))
+	}
+
+	sort.Slice(advice, func(i, j int) bool {
+		if advice[i].Group != advice[j].Group {
+			return advice[i].Group < advice[j].Group
+		}
+
+		return advice[i].Role < advice[j].Role
+	})
+
+	return advice
+}
+
+// analyseRole works out the advice for a single group & role
+func analyseRole(group, role string, activations []pim.Activation, period time.Duration, now time.Time, opts Options) Advice {
+	adv := Advice{Group: group, Role: role}
+
+	requested := []time.Duration{}
+	actual := []time.Duration{}
+	periodStart := now.Add(-period)
+
+	for _, a := range activations {
+		if a.Start.After(adv.LastActivated) {
+			adv.LastActivated = a.Start
+		}
+
+		if a.Start.Before(periodStart) {
+			continue
+		}
+
+		adv.Activations++
+
+		if a.Requested > 0 {
+			requested = append(requested, a.Requested)
+		}
+
+		// Ongoing activations haven't finished, so don't tell us how long they are needed for
+		if !a.Ongoing {
+			actual = append(actual, a.Actual)
+		}
+
+		if a.EndedEarly {
+			adv.EarlyEnds++
+
+			if a.Actual <= opts.QuickDeactivation {
+				adv.QuickEnds++
+			}
+		}
+	}
+
+	if weeks := period.Hours() / (24 * 7); weeks > 0 {
+		adv.PerWeek = float64(adv.Activations) / weeks
+	}
+
+	adv.Unused = adv.LastActivated.IsZero() || now.Sub(adv.LastActivated) > opts.UnusedAfter
+	adv.NotNeeded = adv.Activations > 0 && adv.QuickEnds*2 > adv.Activations
+	adv.TypicalRequested = percentile(requested, 50)
+	adv.TypicalActual = percentile(actual, 50)
+
+	// Suggest enough time to cover nearly all past activations, but only if it's an improvement
+	if len(actual) >= opts.MinActivations {
+		suggested := roundUp(percentile(actual, 90), suggestionStep)
+		if suggested < adv.TypicalRequested {
+			adv.Suggested = suggested
+		}
+	}
+
+	return adv
+}
+
+// percentile returns the p-th percentile of the durations, using the nearest rank method
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// roundUp rounds d up to a multiple of step, and is never less than one step
+func roundUp(d, step time.Duration) time.Duration {
+	if d <= step {
+		return step
+	}
+
+	return ((d + step - 1) / step) * step
+}
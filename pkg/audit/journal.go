@@ -0,0 +1,285 @@
+// ==============================================================================================
+// Local tamper-evident audit journal of privileged actions, stored as JSON lines
+// Each entry holds the hash of the previous one, so any edit or deletion breaks the chain.
+// The hash of the latest entry is also kept in a separate head file, to detect truncation
+// ===============================================================================================
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Actions that are recorded in the journal
+const (
+	ActionRequest    = "request"
+	ActionExtend     = "extend"
+	ActionDeactivate = "deactivate"
+	ActionRenew      = "renew"
+)
+
+// Outcomes of an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is a single record in the audit journal
+type Entry struct {
+	Seq       int       `json:"seq"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	User      string    `json:"user"`
+	UserID    string    `json:"userId"`
+	Tenant    string    `json:"tenant"`
+	TenantID  string    `json:"tenantId"`
+	Group     string    `json:"group"`
+	Role      string    `json:"role"`
+	Duration  string    `json:"duration,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Message   string    `json:"message,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	PrevHash  string    `json:"prevHash"`
+	Hash      string    `json:"hash"`
+}
+
+// Journal is an append only audit journal file
+type Journal struct {
+	path string
+}
+
+// head is stored alongside the journal, recording the latest entry
+type head struct {
+	Seq  int    `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Open returns the journal in the pim-cli directory under the user data dir
+func Open() (*Journal, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenPath(filepath.Join(dir, "pim-cli", "audit.jsonl"))
+}
+
+// OpenPath returns the journal stored in the given file, which is created when first written
+func OpenPath(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit dir: %w", err)
+	}
+
+	return &Journal{path: path}, nil
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append adds an entry to the journal, setting its sequence number, time & hashes
+func (j *Journal) Append(e Entry) (Entry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return e, err
+	}
+
+	e.Seq = 1
+	e.PrevHash = ""
+
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	e.Hash, err = hashEntry(e)
+	if err != nil {
+		return e, err
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return e, fmt.Errorf("failed to open audit journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return e, fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	if err := j.writeHead(head{Seq: e.Seq, Hash: e.Hash}); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+// Entries reads all the entries in the journal, a missing journal has no entries
+func (j *Journal) Entries() ([]Entry, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Entry{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit journal: %w", err)
+	}
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("audit journal line %d is not valid: %w", lineNum, err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Verify checks the hash chain of the whole journal, returning the number of valid entries
+// and an error describing the first problem found, if any
+func (j *Journal) Verify() (int, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	prevHash := ""
+
+	for i, e := range entries {
+		if e.Seq != i+1 {
+			return i, fmt.Errorf("entry %d has sequence number %d, entries have been deleted or reordered", i+1, e.Seq)
+		}
+
+		if e.PrevHash != prevHash {
+			return i, fmt.Errorf("entry %d does not follow the previous entry, entries have been deleted or reordered", e.Seq)
+		}
+
+		hash, err := hashEntry(e)
+		if err != nil {
+			return i, err
+		}
+
+		if hash != e.Hash {
+			return i, fmt.Errorf("entry %d has been modified", e.Seq)
+		}
+
+		prevHash = e.Hash
+	}
+
+	h, err := j.readHead()
+	if err != nil {
+		return len(entries), err
+	}
+
+	if h.Seq != len(entries) || h.Hash != prevHash {
+		return len(entries), fmt.Errorf("journal ends at entry %d but the last recorded entry was %d, entries have been removed",
+			len(entries), h.Seq)
+	}
+
+	return len(entries), nil
+}
+
+// hashEntry computes the hash of an entry, covering all fields except the hash itself
+func hashEntry(e Entry) (string, error) {
+	e.Hash = ""
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// headPath returns the location of the head file
+func (j *Journal) headPath() string {
+	return strings.TrimSuffix(j.path, filepath.Ext(j.path)) + ".head"
+}
+
+func (j *Journal) writeHead(h head) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit head: %w", err)
+	}
+
+	if err := os.WriteFile(j.headPath(), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+
+	return nil
+}
+
+func (j *Journal) readHead() (head, error) {
+	data, err := os.ReadFile(j.headPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return head{}, nil
+	}
+
+	if err != nil {
+		return head{}, fmt.Errorf("failed to read audit head: %w", err)
+	}
+
+	var h head
+	if err := json.Unmarshal(data, &h); err != nil {
+		return head{}, fmt.Errorf("audit head is not valid: %w", err)
+	}
+
+	return h, nil
+}
+
+// dataDir returns the user data dir, Go only provides config & cache dirs so follow XDG on Linux/Unix
+func dataDir() (string, error) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return os.UserConfigDir()
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user data dir: %w", err)
+	}
+
+	return filepath.Join(home, ".local", "share"), nil
+}
@@ -0,0 +1,209 @@
+// ==============================================================================================
+// Creates Azure credentials for the selected authentication method(s)
+// Multiple methods can be given as a comma separated list, and are tried in order
+// ===============================================================================================
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azcloud "github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+)
+
+// Supported authentication methods
+const (
+	MethodDefault          = "default"
+	MethodAzureCLI         = "azcli"
+	MethodDeviceCode       = "device-code"
+	MethodBrowser          = "browser"
+	MethodEnv              = "env"
+	MethodManagedIdentity  = "managed-identity"
+	MethodWorkloadIdentity = "workload-identity"
+	MethodLogin            = "login"
+)
+
+// Methods lists all the supported authentication methods
+var Methods = []string{
+	MethodDefault, MethodAzureCLI, MethodDeviceCode, MethodBrowser,
+	MethodEnv, MethodManagedIdentity, MethodWorkloadIdentity, MethodLogin,
+}
+
+// Options for creating credentials
+type Options struct {
+	// TenantID to authenticate in, empty means the default tenant for the account
+	TenantID string
+
+	// Cloud sets the authority to authenticate against, defaults to the public cloud
+	Cloud cloud.Cloud
+}
+
+// clientOptions returns the azcore client options to use the authority of the selected cloud
+func (o Options) clientOptions() azcore.ClientOptions {
+	return azcore.ClientOptions{
+		Cloud: azcloud.Configuration{
+			ActiveDirectoryAuthorityHost: cloud.Public.WithOverrides(o.Cloud).AuthorityHost,
+		},
+	}
+}
+
+// loginScope returns the scope requested when logging in, tokens for other resources are then acquired silently
+func (o Options) loginScope() string {
+	return strings.TrimSuffix(cloud.Public.WithOverrides(o.Cloud).GraphEndpoint, "/") + "/.default"
+}
+
+// NewCredential creates a credential for the given method, which can be a comma separated
+// list of methods to try in order, e.g. "azcli,device-code". Empty means use the default chain,
+// preceded by the saved session if the user has run 'pim-cli login'
+func NewCredential(method string, opts Options) (azcore.TokenCredential, error) {
+	methods := parseMethods(method)
+
+	if len(methods) == 1 {
+		cred, err := newMethodCredential(methods[0], opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return newMemoryCredential(cred), nil
+	}
+
+	// Chain the methods, skipping any that can't be used here but reporting if none can
+	sources := []azcore.TokenCredential{}
+	unavailable := []string{}
+
+	for _, m := range methods {
+		cred, err := newMethodCredential(m, opts)
+		if err != nil {
+			unavailable = append(unavailable, err.Error())
+			continue
+		}
+
+		sources = append(sources, cred)
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("none of the authentication methods are available:\n  %s", strings.Join(unavailable, "\n  "))
+	}
+
+	chain, err := azidentity.NewChainedTokenCredential(sources, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMemoryCredential(chain), nil
+}
+
+// parseMethods splits a comma separated list of methods, an empty list means the default chain,
+// preceded by the saved session if the user has run 'pim-cli login'
+func parseMethods(method string) []string {
+	methods := []string{}
+
+	for m := range strings.SplitSeq(method, ",") {
+		if m = strings.TrimSpace(strings.ToLower(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+
+	if len(methods) == 0 {
+		methods = []string{MethodDefault}
+		if IsLoggedIn() {
+			methods = []string{MethodLogin, MethodDefault}
+		}
+	}
+
+	return methods
+}
+
+// newMethodCredential creates a credential for a single authentication method
+func newMethodCredential(method string, opts Options) (azcore.TokenCredential, error) {
+	var cred azcore.TokenCredential
+
+	var err error
+
+	switch method {
+	case MethodDefault:
+		cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: opts.clientOptions(),
+			TenantID:      opts.TenantID,
+		})
+
+	case MethodAzureCLI:
+		// NOTE: The Azure CLI must be switched to the right cloud itself, with 'az cloud set'
+		if _, lookErr := exec.LookPath("az"); lookErr != nil {
+			return nil, fmt.Errorf("auth method '%s' is not available: Azure CLI 'az' was not found in PATH", method)
+		}
+
+		cred, err = azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{
+			TenantID: opts.TenantID,
+		})
+
+	case MethodDeviceCode:
+		// Reuse any saved login session & token cache, so we don't prompt every time
+		record, _, _ := LoadRecord()
+		tc, _ := persistentTokenCache()
+		cred, err = azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{
+			AuthenticationRecord: record,
+			Cache:                tc,
+			ClientOptions:        opts.clientOptions(),
+			TenantID:             opts.TenantID,
+			UserPrompt:           devicePrompt,
+		})
+
+	case MethodBrowser:
+		record, _, _ := LoadRecord()
+		tc, _ := persistentTokenCache()
+		cred, err = azidentity.NewInteractiveBrowserCredential(&azidentity.InteractiveBrowserCredentialOptions{
+			AuthenticationRecord: record,
+			Cache:                tc,
+			ClientOptions:        opts.clientOptions(),
+			TenantID:             opts.TenantID,
+		})
+
+	case MethodEnv:
+		// The tenant is fixed by AZURE_TENANT_ID for environment credentials
+		if envTenant := os.Getenv("AZURE_TENANT_ID"); opts.TenantID != "" && envTenant != "" && !strings.EqualFold(envTenant, opts.TenantID) {
+			return nil, fmt.Errorf("auth method '%s' is not available: AZURE_TENANT_ID is set to a different tenant", method)
+		}
+
+		cred, err = azidentity.NewEnvironmentCredential(&azidentity.EnvironmentCredentialOptions{
+			ClientOptions: opts.clientOptions(),
+		})
+
+	case MethodManagedIdentity:
+		// Managed identities only exist in the tenant of the Azure resource they're assigned to
+		cred, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+			ClientOptions: opts.clientOptions(),
+		})
+
+	case MethodWorkloadIdentity:
+		cred, err = azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: opts.clientOptions(),
+			TenantID:      opts.TenantID,
+		})
+
+	case MethodLogin:
+		cred, err = newLoginCredential(opts)
+
+	default:
+		return nil, fmt.Errorf("unknown auth method '%s', must be one of: %s", method, strings.Join(Methods, ", "))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("auth method '%s' is not available: %w", method, err)
+	}
+
+	return cred, nil
+}
+
+// devicePrompt shows the device code login message, on stderr so it doesn't mix with command output
+func devicePrompt(_ context.Context, msg azidentity.DeviceCodeMessage) error {
+	_, err := fmt.Fprintln(os.Stderr, msg.Message)
+	return err
+}
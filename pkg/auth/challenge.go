@@ -0,0 +1,35 @@
+// ==============================================================================================
+// Interactive credentials for answering claims challenges, e.g. when a PIM policy needs MFA or
+// a Conditional Access authentication context, which non-interactive tokens can't satisfy
+// ===============================================================================================
+
+package auth
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// NewChallengeCredential creates an interactive credential able to get tokens with extra claims.
+// The browser is used when there's a display, otherwise a device code. Returns the method used
+func NewChallengeCredential(opts Options) (azcore.TokenCredential, string, error) {
+	method := MethodBrowser
+	if !hasDisplay() {
+		method = MethodDeviceCode
+	}
+
+	cred, err := newMethodCredential(method, opts)
+
+	return cred, method, err
+}
+
+// hasDisplay guesses if a browser can be opened, i.e. not over SSH or in a container on Linux
+func hasDisplay() bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
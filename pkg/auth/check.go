@@ -0,0 +1,41 @@
+// ==============================================================================================
+// Checks which authentication methods can be used on this machine, to help diagnose problems
+// ===============================================================================================
+
+package auth
+
+// The parts of the default chain that can be checked locally, managed identity can only be found by trying it
+var defaultChainMethods = []string{MethodEnv, MethodWorkloadIdentity, MethodAzureCLI}
+
+// MethodStatus is whether an authentication method can be used on this machine
+type MethodStatus struct {
+	Method string
+
+	// Parent is set to the default method for the parts of the default chain
+	Parent string
+
+	// Err is why the method can't be used, nil if it can
+	Err error
+}
+
+// CheckMethods reports which of the given methods can be used, in the order they would be tried.
+// The default chain is expanded to show which of its parts are available
+func CheckMethods(method string, opts Options) []MethodStatus {
+	statuses := []MethodStatus{}
+
+	for _, m := range parseMethods(method) {
+		_, err := newMethodCredential(m, opts)
+		statuses = append(statuses, MethodStatus{Method: m, Err: err})
+
+		if m != MethodDefault || err != nil {
+			continue
+		}
+
+		for _, part := range defaultChainMethods {
+			_, err := newMethodCredential(part, opts)
+			statuses = append(statuses, MethodStatus{Method: part, Parent: MethodDefault, Err: err})
+		}
+	}
+
+	return statuses
+}
@@ -0,0 +1,245 @@
+// ==============================================================================================
+// Persistent sign in with 'pim-cli login', for when the Azure CLI isn't available
+// Tokens are kept in the azidentity persistent (encrypted) token cache, and the non-secret
+// authentication record is saved to disk so later commands can silently reuse the session
+// ===============================================================================================
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity/cache"
+)
+
+// Name of the persistent token cache, keeps our tokens apart from other applications
+const tokenCacheName = "pim-cli"
+
+var (
+	tokenCacheOnce sync.Once
+	tokenCache     azidentity.Cache
+	tokenCacheErr  error
+)
+
+// Login signs in interactively, with the browser or a device code, and saves the authentication
+// record so later commands can reuse the session without prompting
+func Login(ctx context.Context, useDeviceCode bool, opts Options) (azidentity.AuthenticationRecord, error) {
+	tc, err := persistentTokenCache()
+	if err != nil {
+		return azidentity.AuthenticationRecord{}, err
+	}
+
+	var record azidentity.AuthenticationRecord
+
+	tokenOpts := &policy.TokenRequestOptions{Scopes: []string{opts.loginScope()}}
+
+	if useDeviceCode {
+		cred, err := azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{
+			Cache:         tc,
+			ClientOptions: opts.clientOptions(),
+			TenantID:      opts.TenantID,
+			UserPrompt:    devicePrompt,
+		})
+		if err != nil {
+			return record, err
+		}
+
+		record, err = cred.Authenticate(ctx, tokenOpts)
+		if err != nil {
+			return record, fmt.Errorf("device code login failed: %w", err)
+		}
+	} else {
+		cred, err := azidentity.NewInteractiveBrowserCredential(&azidentity.InteractiveBrowserCredentialOptions{
+			Cache:         tc,
+			ClientOptions: opts.clientOptions(),
+			TenantID:      opts.TenantID,
+		})
+		if err != nil {
+			return record, err
+		}
+
+		record, err = cred.Authenticate(ctx, tokenOpts)
+		if err != nil {
+			return record, fmt.Errorf("browser login failed: %w", err)
+		}
+	}
+
+	if err := saveRecord(record); err != nil {
+		return record, err
+	}
+
+	return record, nil
+}
+
+// Logout removes the saved authentication record and the persistent token cache
+func Logout() error {
+	path, err := recordPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove login record: %w", err)
+	}
+
+	cacheFiles, err := tokenCacheFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range cacheFiles {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove token cache: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// LoadRecord returns the saved authentication record, and false if not logged in
+func LoadRecord() (azidentity.AuthenticationRecord, bool, error) {
+	var record azidentity.AuthenticationRecord
+
+	path, err := recordPath()
+	if err != nil {
+		return record, false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return record, false, nil
+	}
+
+	if err != nil {
+		return record, false, fmt.Errorf("failed to read login record: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, false, fmt.Errorf("failed to parse login record: %w", err)
+	}
+
+	return record, true, nil
+}
+
+// IsLoggedIn returns true when there is a saved login from 'pim-cli login'
+func IsLoggedIn() bool {
+	_, ok, err := LoadRecord()
+	return ok && err == nil
+}
+
+// newLoginCredential creates a credential that silently uses the saved login session,
+// it never prompts, and reports as unavailable if the user needs to login again
+func newLoginCredential(opts Options) (azcore.TokenCredential, error) {
+	record, ok, err := LoadRecord()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("not logged in, run 'pim-cli login' first")
+	}
+
+	tc, err := persistentTokenCache()
+	if err != nil {
+		return nil, err
+	}
+
+	return azidentity.NewInteractiveBrowserCredential(&azidentity.InteractiveBrowserCredentialOptions{
+		AuthenticationRecord:           record,
+		Cache:                          tc,
+		ClientOptions:                  opts.clientOptions(),
+		DisableAutomaticAuthentication: true,
+		TenantID:                       opts.TenantID,
+	})
+}
+
+// persistentTokenCache returns the encrypted on-disk token cache, this isn't available everywhere
+// e.g. on Linux it needs the kernel keyring
+func persistentTokenCache() (azidentity.Cache, error) {
+	tokenCacheOnce.Do(func() {
+		tokenCache, tokenCacheErr = cache.New(&cache.Options{Name: tokenCacheName})
+		if tokenCacheErr != nil {
+			tokenCacheErr = fmt.Errorf("persistent token cache is not available: %w", tokenCacheErr)
+		}
+	})
+
+	return tokenCache, tokenCacheErr
+}
+
+// saveRecord writes the authentication record to disk, it contains no secrets
+func saveRecord(record azidentity.AuthenticationRecord) error {
+	path, err := recordPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode login record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save login record: %w", err)
+	}
+
+	return nil
+}
+
+// recordPath returns where the authentication record is saved
+func recordPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config dir: %w", err)
+	}
+
+	return filepath.Join(dir, "pim-cli", "login.json"), nil
+}
+
+// tokenCacheFiles returns the files used by the persistent token cache.
+// The cache package doesn't expose these, so this mirrors the locations it uses on each OS.
+// On macOS the encryption key lives in the keychain, but without the file it's of no use
+func tokenCacheFiles() ([]string, error) {
+	var dir string
+
+	var err error
+
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("LOCALAPPDATA")
+	case "darwin":
+		dir, err = os.UserHomeDir()
+	default:
+		if dir = os.Getenv("XDG_CACHE_HOME"); dir == "" {
+			if dir, err = os.UserHomeDir(); err == nil {
+				dir = filepath.Join(dir, ".cache")
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find token cache dir: %w", err)
+	}
+
+	if dir == "" {
+		return nil, fmt.Errorf("failed to find token cache dir")
+	}
+
+	base := filepath.Join(dir, ".IdentityService", tokenCacheName)
+
+	return []string{base, base + ".cae"}, nil
+}
@@ -0,0 +1,73 @@
+// ==============================================================================================
+// In memory token caching, so a token is only acquired once per run for each scope.
+// Some credentials (e.g. the Azure CLI) do no caching of their own and are slow to call
+// ==============================================================================================
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Tokens are refreshed this long before they expire, so they don't expire mid request
+const tokenRefreshMargin = 5 * time.Minute
+
+// memoryCredential wraps a credential, caching the tokens it returns in memory until they're near expiry
+type memoryCredential struct {
+	cred   azcore.TokenCredential
+	mu     sync.Mutex
+	tokens map[string]*memoryToken
+}
+
+// memoryToken is a cached token, the lock stops concurrent requests for the same scope all fetching a token
+type memoryToken struct {
+	mu    sync.Mutex
+	token azcore.AccessToken
+}
+
+func newMemoryCredential(cred azcore.TokenCredential) *memoryCredential {
+	return &memoryCredential{cred: cred, tokens: map[string]*memoryToken{}}
+}
+
+// GetToken implements azcore.TokenCredential
+func (c *memoryCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	// Claims challenges always need a new token
+	if opts.Claims != "" {
+		return c.cred.GetToken(ctx, opts)
+	}
+
+	key := fmt.Sprintf("%s|%t|%s", opts.TenantID, opts.EnableCAE, strings.Join(opts.Scopes, " "))
+
+	c.mu.Lock()
+
+	cached, ok := c.tokens[key]
+	if !ok {
+		cached = &memoryToken{}
+		c.tokens[key] = cached
+	}
+
+	c.mu.Unlock()
+
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if time.Until(cached.token.ExpiresOn) > tokenRefreshMargin {
+		return cached.token, nil
+	}
+
+	token, err := c.cred.GetToken(ctx, opts)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	cached.token = token
+
+	return token, nil
+}
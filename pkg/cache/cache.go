@@ -0,0 +1,114 @@
+// ==============================================================================================
+// Simple on-disk cache for slow lookups, stored under the user cache dir
+// Each entry is a small JSON file holding the value and when it expires
+// ===============================================================================================
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Cache stores JSON encoded values with an expiry time in a directory on disk
+type Cache struct {
+	dir   string
+	scope string
+}
+
+// entry is what gets written to disk for each cached item
+type entry struct {
+	Expires time.Time       `json:"expires"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// Used to make keys safe to use as file names
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// New returns a cache stored in the pim-cli directory under the user cache dir
+func New() (*Cache, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user cache dir: %w", err)
+	}
+
+	return NewInDir(filepath.Join(base, "pim-cli"))
+}
+
+// NewInDir returns a cache stored in the given directory, which is created if needed
+func NewInDir(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	return &Cache{dir: dir}, nil
+}
+
+// Get decodes the cached value for key into result, returning false if missing or expired
+func (c *Cache) Get(key string, result any) bool {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return false
+	}
+
+	if time.Now().After(e.Expires) {
+		return false
+	}
+
+	return json.Unmarshal(e.Value, result) == nil
+}
+
+// Set stores value under key, it will expire after ttl
+func (c *Cache) Set(key string, value any, ttl time.Duration) error {
+	valueData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache value: %w", err)
+	}
+
+	data, err := json.Marshal(entry{Expires: time.Now().Add(ttl), Value: valueData})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	if err := os.WriteFile(c.path(key), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// Scoped returns a view of the cache where all keys are prefixed with scope,
+// e.g. to keep entries for different accounts apart
+func (c *Cache) Scoped(scope string) *Cache {
+	return &Cache{dir: c.dir, scope: c.scope + scope + "-"}
+}
+
+// Clear removes all entries from the cache, regardless of scope
+func (c *Cache) Clear() error {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// path returns the file used to store the given key
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, unsafeChars.ReplaceAllString(c.scope+key, "_")+".json")
+}
@@ -0,0 +1,265 @@
+// ===========================================================================================
+// Recording of API requests & responses to a directory (a cassette), and replaying them
+// later without the network or credentials. Cassettes can be attached to bug reports, so
+// odd API responses can be reproduced, and turned into regression tests.
+// Secrets are removed before anything is written, tokens are never recorded, and the user &
+// tenant IDs, UPN and email domain are replaced with made up ones
+// ===========================================================================================
+
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/output"
+	"github.com/benc-uk/pim-cli/pkg/trace"
+	"github.com/google/uuid"
+)
+
+// File holding the identity of the recorded user, the rest of the files are interactions
+const identityFile = "identity.json"
+
+// Made up UPN & email domain recorded in place of the real ones
+const (
+	pseudoUPN    = "user@example.com"
+	pseudoDomain = "example.com"
+)
+
+// Interaction is a recorded request & the response to it
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request, with secrets removed
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response, with secrets removed
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is a transport which records every request & response to a directory
+type Recorder struct {
+	base http.RoundTripper
+	dir  string
+
+	mu       sync.Mutex
+	count    int
+	identity bool
+	warned   bool
+
+	// Pseudonyms for the user's identifying values, set from the first token seen
+	pseudonyms map[string]string
+	identifier *regexp.Regexp
+}
+
+// NewRecorder creates a recorder which saves the traffic through base to dir, creating it if needed
+func NewRecorder(dir string, base http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+
+	// Mixing recordings would make replays unpredictable
+	if existing, _ := filepath.Glob(filepath.Join(dir, "[0-9]*.json")); len(existing) > 0 {
+		return nil, fmt.Errorf("cassette directory %s already has recordings, use an empty directory", dir)
+	}
+
+	return &Recorder{base: base, dir: dir}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	r.saveIdentity(req)
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if err != nil {
+		return resp, err
+	}
+
+	r.save(Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.pseudonymise(trace.Redact(req.URL.String())),
+			Header: r.pseudonymiseHeader(trace.RedactHeaders(req.Header)),
+			Body:   r.pseudonymise(trace.Redact(string(reqBody))),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.pseudonymiseHeader(trace.RedactHeaders(resp.Header)),
+			Body:       r.pseudonymise(trace.Redact(string(respBody))),
+		},
+	})
+
+	return resp, nil
+}
+
+// save writes an interaction to the next numbered file, failures are warned about but don't stop the request
+func (r *Recorder) save(i Interaction) {
+	r.mu.Lock()
+	r.count++
+	name := fmt.Sprintf("%04d-%s-%s.json", r.count, strings.ToLower(i.Request.Method), path.Base(strings.Split(i.Request.URL, "?")[0]))
+	r.mu.Unlock()
+
+	if err := writeJSON(filepath.Join(r.dir, name), i); err != nil {
+		r.warn(err)
+	}
+}
+
+// saveIdentity writes the identity claims from the first bearer token seen, so replays are for the same user.
+// Only the pseudonymised user & tenant IDs are kept, the token itself is never saved
+func (r *Recorder) saveIdentity(req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return
+	}
+
+	claims, err := graph.ParseTokenClaims(token)
+	if err != nil || claims.ObjectID == "" {
+		return
+	}
+
+	// Pseudonyms are set in the same lock as the flag, so they're in place before any interaction is saved
+	r.mu.Lock()
+	saved := r.identity
+	r.identity = true
+
+	if !saved {
+		r.setPseudonyms(claims)
+	}
+	r.mu.Unlock()
+
+	if saved {
+		return
+	}
+
+	// Only the claims a replay needs, read back into graph.TokenClaims by Load. The scopes & identity type
+	// tell a user from an application
+	identity := struct {
+		ObjectID     string   `json:"oid"`
+		TenantID     string   `json:"tid"`
+		Scopes       string   `json:"scp,omitempty"`
+		IdentityType string   `json:"idtyp,omitempty"`
+		AuthMethods  []string `json:"amr,omitempty"`
+	}{
+		ObjectID:     r.pseudonymise(claims.ObjectID),
+		TenantID:     r.pseudonymise(claims.TenantID),
+		Scopes:       claims.Scopes,
+		IdentityType: claims.IdentityType,
+		AuthMethods:  claims.AuthMethods,
+	}
+
+	if err := writeJSON(filepath.Join(r.dir, identityFile), identity); err != nil {
+		r.warn(err)
+	}
+}
+
+// setPseudonyms picks new IDs for the user & tenant, and maps their UPN & email domain to example ones
+func (r *Recorder) setPseudonyms(claims graph.TokenClaims) {
+	r.pseudonyms = map[string]string{
+		strings.ToLower(claims.ObjectID): uuid.NewString(),
+		strings.ToLower(claims.TenantID): uuid.NewString(),
+	}
+
+	for _, upn := range []string{claims.UPN, claims.UniqueName} {
+		if _, domain, ok := strings.Cut(upn, "@"); ok {
+			r.pseudonyms[strings.ToLower(upn)] = pseudoUPN
+			r.pseudonyms[strings.ToLower(domain)] = pseudoDomain
+		}
+	}
+
+	// Longest first, so a UPN is replaced as a whole rather than just its domain
+	values := []string{}
+	for v := range r.pseudonyms {
+		if v != "" {
+			values = append(values, regexp.QuoteMeta(v))
+		}
+	}
+
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	r.identifier = regexp.MustCompile("(?i)" + strings.Join(values, "|"))
+}
+
+// pseudonymise replaces the user's identifying values in s, the same way across every file in the cassette
+func (r *Recorder) pseudonymise(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.identifier == nil || s == "" {
+		return s
+	}
+
+	return r.identifier.ReplaceAllStringFunc(s, func(v string) string {
+		return r.pseudonyms[strings.ToLower(v)]
+	})
+}
+
+// pseudonymiseHeader replaces the user's identifying values in the header values
+func (r *Recorder) pseudonymiseHeader(h http.Header) http.Header {
+	for name, values := range h {
+		for n, v := range values {
+			h[name][n] = r.pseudonymise(v)
+		}
+	}
+
+	return h
+}
+
+// warn warns about a failure to record, only once as it's likely to keep happening
+func (r *Recorder) warn(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.warned {
+		r.warned = true
+		output.Warn("Failed to record to cassette: %v", err)
+	}
+}
+
+func writeJSON(file string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0o600)
+}
@@ -0,0 +1,94 @@
+// ==============================================================================================
+// Endpoints for the Azure public & sovereign clouds
+// The PIM, Graph and authority endpoints always need to be switched together
+// ===============================================================================================
+
+package cloud
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Cloud holds the endpoints used for an Azure cloud
+type Cloud struct {
+	// AuthorityHost is the Entra ID (AAD) login endpoint
+	AuthorityHost string `json:"authority,omitempty"`
+
+	// GraphEndpoint is the Microsoft Graph API endpoint, without a version path
+	GraphEndpoint string `json:"graph,omitempty"`
+
+	// PIMEndpoint is the Azure RBAC PIM API endpoint, without any path
+	PIMEndpoint string `json:"pim,omitempty"`
+}
+
+// Public is the global Azure cloud, used by most people
+var Public = Cloud{
+	AuthorityHost: "https://login.microsoftonline.com/",
+	GraphEndpoint: "https://graph.microsoft.com",
+	PIMEndpoint:   "https://api.azrbac.mspim.azure.com",
+}
+
+// USGov is the Azure US Government cloud
+var USGov = Cloud{
+	AuthorityHost: "https://login.microsoftonline.us/",
+	GraphEndpoint: "https://graph.microsoft.us",
+	PIMEndpoint:   "https://api.azrbac.mspim.azure.us",
+}
+
+// China is the Azure China cloud, operated by 21Vianet
+var China = Cloud{
+	AuthorityHost: "https://login.chinacloudapi.cn/",
+	GraphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+	PIMEndpoint:   "https://api.azrbac.mspim.azure.cn",
+}
+
+var clouds = map[string]Cloud{
+	"public": Public,
+	"usgov":  USGov,
+	"china":  China,
+}
+
+// Names returns the names of the known clouds
+func Names() []string {
+	names := []string{}
+	for name := range clouds {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Get returns the cloud with the given name, empty means the public cloud
+func Get(name string) (Cloud, error) {
+	if name == "" {
+		return Public, nil
+	}
+
+	c, ok := clouds[strings.ToLower(name)]
+	if !ok {
+		return Cloud{}, fmt.Errorf("unknown cloud '%s', must be one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	return c, nil
+}
+
+// WithOverrides returns a copy of the cloud, with any endpoints set in overrides replacing its own
+func (c Cloud) WithOverrides(overrides Cloud) Cloud {
+	if overrides.AuthorityHost != "" {
+		c.AuthorityHost = overrides.AuthorityHost
+	}
+
+	if overrides.GraphEndpoint != "" {
+		c.GraphEndpoint = overrides.GraphEndpoint
+	}
+
+	if overrides.PIMEndpoint != "" {
+		c.PIMEndpoint = overrides.PIMEndpoint
+	}
+
+	return c
+}
@@ -0,0 +1,122 @@
+// ==============================================================================================
+// Optional user config file, stored as JSON under the user config dir
+// Values set here act as defaults, command line flags always take precedence
+// ===============================================================================================
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+)
+
+// Config holds all the settings that can be set in the config file
+type Config struct {
+	// Auth is the authentication method(s) to use, see the auth package for valid values
+	Auth string `json:"auth,omitempty"`
+
+	// Tenant is the default tenant, an ID or an alias from Tenants
+	Tenant string `json:"tenant,omitempty"`
+
+	// Tenants are named tenant profiles, keyed by alias
+	Tenants map[string]Tenant `json:"tenants,omitempty"`
+
+	// Cloud is the Azure cloud to use, see the cloud package for valid names
+	Cloud string `json:"cloud,omitempty"`
+
+	// Endpoints are custom overrides of the cloud's authority, Graph and PIM endpoints
+	Endpoints cloud.Cloud `json:"endpoints,omitzero"`
+
+	// Backend is the API used to manage PIM groups, see the pim package for valid names
+	Backend string `json:"backend,omitempty"`
+
+	// ExpiryWarningDays is how many days before an eligibility ends to start warning, negative disables
+	ExpiryWarningDays int `json:"expiryWarningDays,omitempty"`
+}
+
+// Default number of days before an eligibility ends to start warning
+const defaultExpiryWarningDays = 14
+
+// Tenant is a named tenant profile
+type Tenant struct {
+	// ID of the tenant, a GUID or domain name
+	ID string `json:"id"`
+
+	// Auth overrides the authentication method(s) when using this tenant
+	Auth string `json:"auth,omitempty"`
+
+	// Cloud overrides the Azure cloud when using this tenant
+	Cloud string `json:"cloud,omitempty"`
+
+	// Backend overrides the API used to manage PIM groups when using this tenant
+	Backend string `json:"backend,omitempty"`
+}
+
+// ResolveTenant looks up a tenant profile by alias, anything else is treated as a tenant ID.
+// Returns the alias (empty if not a profile) and the tenant
+func (c Config) ResolveTenant(nameOrID string) (string, Tenant) {
+	if t, ok := c.Tenants[nameOrID]; ok {
+		return nameOrID, t
+	}
+
+	return "", Tenant{ID: nameOrID}
+}
+
+// ExpiryWarning returns how long before an eligibility ends to start warning, zero when disabled
+func (c Config) ExpiryWarning() time.Duration {
+	days := c.ExpiryWarningDays
+	if days == 0 {
+		days = defaultExpiryWarningDays
+	}
+
+	if days < 0 {
+		return 0
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Path returns the location of the config file, this can be overridden with PIM_CLI_CONFIG
+func Path() (string, error) {
+	if path := os.Getenv("PIM_CLI_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config dir: %w", err)
+	}
+
+	return filepath.Join(dir, "pim-cli", "config.json"), nil
+}
+
+// Load reads the config file, a missing file is not an error and returns an empty config
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
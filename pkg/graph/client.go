@@ -7,42 +7,88 @@ package graph
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+	"github.com/benc-uk/pim-cli/pkg/trace"
 )
 
-const (
-	graphAPIScope   = "https://graph.microsoft.com/.default"
-	graphAPIBaseURL = "https://graph.microsoft.com/beta"
-)
+// We use the beta API, as it returns more useful user properties
+const graphAPIVersion = "/beta"
 
 // Client wraps HTTP client with Azure authentication for Microsoft Graph API
 type Client struct {
 	cred       azcore.TokenCredential
 	httpClient *http.Client
+	scope      string
+	baseURL    string
+	userAgent  string
+}
+
+// ClientOptions configures a Graph API client
+type ClientOptions struct {
+	// Cloud sets the Graph endpoint to use, defaults to the public cloud
+	Cloud cloud.Cloud
+
+	// HTTPClient is used for all requests, defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	// UserAgent is sent with all requests, defaults to pim-cli
+	UserAgent string
 }
 
-// NewClient creates a new Graph API client with the given Azure credential
-func NewClient(cred azcore.TokenCredential) *Client {
+// NewClient creates a new Graph API client with the given Azure credential, options can be nil
+func NewClient(cred azcore.TokenCredential, opts *ClientOptions) *Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	endpoint := strings.TrimSuffix(cloud.Public.WithOverrides(opts.Cloud).GraphEndpoint, "/")
+
 	return &Client{
 		cred:       cred,
-		httpClient: http.DefaultClient,
+		httpClient: httpClient,
+		scope:      endpoint + "/.default",
+		baseURL:    endpoint + graphAPIVersion,
+		userAgent:  cmp.Or(opts.UserAgent, "pim-cli"),
 	}
 }
 
-// Request performs an authenticated request to the Microsoft Graph API
-func (c *Client) Request(ctx context.Context, method, url string, body []byte, result any) error {
+// BaseURL returns the versioned base URL of the Graph API, for building request URLs
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// GetToken acquires an access token for the Microsoft Graph API
+func (c *Client) GetToken(ctx context.Context) (azcore.AccessToken, error) {
 	token, err := c.cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{graphAPIScope},
+		Scopes: []string{c.scope},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to get Graph API token: %w", err)
+		return azcore.AccessToken{}, fmt.Errorf("failed to get Graph API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Request performs an authenticated request to the Microsoft Graph API
+func (c *Client) Request(ctx context.Context, method, url string, body []byte, result any) error {
+	token, err := c.GetToken(ctx)
+	if err != nil {
+		return err
 	}
 
 	var bodyReader io.Reader
@@ -57,6 +103,7 @@ func (c *Client) Request(ctx context.Context, method, url string, body []byte, r
 
 	req.Header.Set("Authorization", "Bearer "+token.Token)
 	req.Header.Set("Content-Type", "application/json")
+	trace.SetHeaders(req, c.userAgent)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -67,7 +114,7 @@ func (c *Client) Request(ctx context.Context, method, url string, body []byte, r
 	respBody, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("graph API error: %s - %s", resp.Status, string(respBody))
+		return newError(resp, respBody)
 	}
 
 	if result != nil && len(respBody) > 0 {
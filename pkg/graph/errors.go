@@ -0,0 +1,66 @@
+// ==============================================================================================
+// Lightweight Microsoft Graph API client wrapper
+//
+// errors.go: Error responses from the Graph API, with the IDs needed for support cases
+// ===============================================================================================
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benc-uk/pim-cli/pkg/trace"
+)
+
+// Error is an error response from the Graph API
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+
+	// IDs of the failed request, Microsoft support will ask for these
+	IDs trace.RequestIDs
+}
+
+// errorResponse is the body of a Graph API error
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("graph API error: %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+
+	msg += " - " + e.Message
+
+	if ids := e.IDs.String(); ids != "" {
+		msg += " " + ids
+	}
+
+	return msg
+}
+
+// newError creates an Error from a failed response, the IDs come from the headers
+func newError(resp *http.Response, body []byte) *Error {
+	graphErr := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		IDs:        trace.IDsFromResponse(resp),
+	}
+
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		graphErr.Code = errResp.Error.Code
+		graphErr.Message = errResp.Error.Message
+	}
+
+	return graphErr
+}
@@ -0,0 +1,68 @@
+// ==============================================================================================
+// Lightweight Microsoft Graph API client wrapper
+//
+// token.go: Reading the identity claims from access tokens
+// ===============================================================================================
+
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TokenClaims holds the identity claims we care about from an Entra ID access token
+type TokenClaims struct {
+	ObjectID       string   `json:"oid"`
+	TenantID       string   `json:"tid"`
+	UPN            string   `json:"upn"`
+	UniqueName     string   `json:"unique_name"`
+	Name           string   `json:"name"`
+	Scopes         string   `json:"scp"`
+	Roles          []string `json:"roles"`
+	AuthMethods    []string `json:"amr"`
+	Audience       string   `json:"aud"`
+	IdentityType   string   `json:"idtyp"`
+	AppDisplayName string   `json:"app_displayname"`
+}
+
+// AppOnly returns true for tokens issued to an application rather than a user, e.g. a service principal.
+// The idtyp claim is optional, so a token without delegated scopes is treated as app-only too
+func (c TokenClaims) AppOnly() bool {
+	return c.IdentityType == "app" || c.Scopes == ""
+}
+
+// GetTokenClaims acquires a Graph API token and returns the identity claims from it.
+// This is a local operation (unless the token needs refreshing) so is much faster than calling Graph
+func (c *Client) GetTokenClaims(ctx context.Context) (TokenClaims, error) {
+	token, err := c.GetToken(ctx)
+	if err != nil {
+		return TokenClaims{}, err
+	}
+
+	return ParseTokenClaims(token.Token)
+}
+
+// ParseTokenClaims decodes the claims from a JWT access token.
+// NOTE: The signature is NOT validated, never use this for making any security decisions
+func ParseTokenClaims(token string) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, fmt.Errorf("access token is not a valid JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("failed to decode token payload: %w", err)
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return TokenClaims{}, fmt.Errorf("failed to decode token claims: %w", err)
+	}
+
+	return claims, nil
+}
@@ -30,6 +30,10 @@ type User struct {
 	Alias             string `json:"onPremisesSamAccountName"`
 }
 
+// Fields of the user to fetch, as many aren't returned by default
+const userSelect = "id,displayName,userPrincipalName,mail,givenName,surname,jobTitle,department,officeLocation," +
+	"city,companyName,employeeId,accountEnabled,onPremisesSamAccountName"
+
 // Organization represents a tenant organization from the Graph API
 type Organization struct {
 	DisplayName string `json:"displayName"`
@@ -42,7 +46,7 @@ type organizationResponse struct {
 
 // GetCurrentUser gets the current user's object ID and display name using Microsoft Graph REST API
 func GetCurrentUser(ctx context.Context, client *Client) (User, error) {
-	reqURL := graphAPIBaseURL + "/me"
+	reqURL := client.BaseURL() + "/me?$select=" + userSelect
 
 	var user User
 	if err := client.Request(ctx, http.MethodGet, reqURL, nil, &user); err != nil {
@@ -54,7 +58,7 @@ func GetCurrentUser(ctx context.Context, client *Client) (User, error) {
 
 // GetTenantInfo gets the current tenant's display name using Microsoft Graph REST API
 func GetTenantInfo(ctx context.Context, client *Client) (string, error) {
-	reqURL := graphAPIBaseURL + "/organization?$select=displayName"
+	reqURL := client.BaseURL() + "/organization?$select=displayName"
 
 	var resp organizationResponse
 	if err := client.Request(ctx, http.MethodGet, reqURL, nil, &resp); err != nil {
@@ -0,0 +1,51 @@
+// =====================================================================
+// Debug logging, enabled with -v or --debug, written to stderr or a file
+// =====================================================================
+
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Debug levels, each one includes everything from the levels below
+const (
+	// DebugOff - no debug logging (default)
+	DebugOff = iota
+	// DebugRequests - a summary line for each HTTP request, with correlation IDs
+	DebugRequests
+	// DebugFull - the full headers & bodies of each HTTP request
+	DebugFull
+)
+
+var (
+	debugLevel            = DebugOff
+	debugWriter io.Writer = os.Stderr
+)
+
+// SetDebug sets the debug level, and where debug logs are written, nil means stderr
+func SetDebug(level int, w io.Writer) {
+	debugLevel = level
+	debugWriter = w
+
+	if debugWriter == nil {
+		debugWriter = os.Stderr
+	}
+}
+
+// DebugLevel returns the current debug level
+func DebugLevel() int {
+	return debugLevel
+}
+
+// Debugf writes a timestamped debug message, if the debug level is at least level
+func Debugf(level int, format string, args ...any) {
+	if debugLevel < level {
+		return
+	}
+
+	fmt.Fprintf(debugWriter, "[%s] "+format+"\n", append([]any{time.Now().Format("15:04:05.000")}, args...)...)
+}
@@ -1,5 +1,6 @@
 // =====================================================================
-// Pretty basic console/stdout output package with two verbosity levels
+// Console output package, with quiet & normal output, verbose (-v) &
+// debug (--debug) logging of HTTP requests, styles and templates
 // =====================================================================
 
 package output
@@ -47,7 +48,7 @@ func Printf(format string, args ...any) {
 
 // Error outputs an error message (always shown, even in Quiet mode)
 func Error(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	fmt.Fprintln(os.Stderr, StyleFailure.renderErr(fmt.Sprintf("Error: "+format, args...)))
 }
 
 // Printlnq outputs a message that is always shown (even in Quiet mode)
@@ -60,8 +61,7 @@ func Printfq(format string, args ...any) {
 	fmt.Printf(format, args...)
 }
 
-// Fatalf outputs an error message and exits with code 1
-func Fatalf(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "\033[31mError: "+format+"\033[0m", args...)
-	os.Exit(1)
+// Warn outputs a warning message to stderr (always shown, even in Quiet mode)
+func Warn(format string, args ...any) {
+	fmt.Fprintln(os.Stderr, StyleWarning.renderErr(fmt.Sprintf("Warning: "+format, args...)))
 }
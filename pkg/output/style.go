@@ -0,0 +1,128 @@
+// =====================================================================
+// Semantic text styles, rendered as ANSI colours only when wanted.
+// Colour is on for terminals, and off when piped, if NO_COLOR is set,
+// or if forced either way with --color always|never
+// =====================================================================
+
+package output
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rodaine/table"
+)
+
+// Style is a semantic text style, the value is the ANSI SGR code it's rendered with
+type Style string
+
+// Styles used across all commands
+const (
+	StyleBanner    Style = "35"   // The CLI banner & tenant titles
+	StyleHeading   Style = "33"   // Group names, section & table headings
+	StyleLabel     Style = "34"   // Field labels
+	StyleSuccess   Style = "32"   // Things that went well
+	StyleWarning   Style = "33"   // Things needing attention
+	StyleFailure   Style = "31"   // Errors & failures
+	StyleInfo      Style = "36"   // Secondary details, e.g. time left
+	StyleHighlight Style = "1;32" // Values the user asked for, e.g. group & role names
+	StyleMuted     Style = "90"   // Things that didn't apply, e.g. skipped checks
+)
+
+// Colour modes for SetColor
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// ColorModes lists the valid colour modes
+var ColorModes = []string{ColorAuto, ColorAlways, ColorNever}
+
+// Whether colour is used on stdout & stderr, these are detected separately as one might be piped
+var (
+	colorOut = autoColor(os.Stdout)
+	colorErr = autoColor(os.Stderr)
+)
+
+// SetColor sets when colour is used, auto means only on terminals & when NO_COLOR isn't set
+func SetColor(mode string) error {
+	switch mode {
+	case ColorAuto, "":
+		colorOut, colorErr = autoColor(os.Stdout), autoColor(os.Stderr)
+	case ColorAlways:
+		colorOut, colorErr = true, true
+	case ColorNever:
+		colorOut, colorErr = false, false
+	default:
+		return fmt.Errorf("invalid color mode '%s', must be one of: auto, always, never", mode)
+	}
+
+	return nil
+}
+
+// autoColor returns true if f is a terminal, and colour hasn't been turned off with NO_COLOR or TERM=dumb
+func autoColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	stat, err := f.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Render returns text in the style, for output to stdout
+func (s Style) Render(text string) string {
+	return s.render(text, colorOut)
+}
+
+// renderErr returns text in the style, for output to stderr
+func (s Style) renderErr(text string) string {
+	return s.render(text, colorErr)
+}
+
+func (s Style) render(text string, enabled bool) string {
+	if !enabled || s == "" {
+		return text
+	}
+
+	return "\033[" + string(s) + "m" + text + "\033[0m"
+}
+
+// Banner styles the CLI banner & tenant titles
+func Banner(text string) string { return StyleBanner.Render(text) }
+
+// Heading styles group names, section & table headings
+func Heading(text string) string { return StyleHeading.Render(text) }
+
+// Label styles field labels
+func Label(text string) string { return StyleLabel.Render(text) }
+
+// Success styles things that went well
+func Success(text string) string { return StyleSuccess.Render(text) }
+
+// Warning styles things needing attention
+func Warning(text string) string { return StyleWarning.Render(text) }
+
+// Failure styles errors & failures
+func Failure(text string) string { return StyleFailure.Render(text) }
+
+// Info styles secondary details
+func Info(text string) string { return StyleInfo.Render(text) }
+
+// Highlight styles values the user asked for
+func Highlight(text string) string { return StyleHighlight.Render(text) }
+
+// Muted styles things that didn't apply
+func Muted(text string) string { return StyleMuted.Render(text) }
+
+// NewTable creates a table for quiet mode output, with styled headings
+func NewTable(columns ...any) table.Table {
+	tbl := table.New(columns...)
+	tbl.WithHeaderFormatter(func(format string, a ...any) string {
+		return Heading(fmt.Sprintf(format, a...))
+	})
+
+	return tbl
+}
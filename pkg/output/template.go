@@ -0,0 +1,105 @@
+// =====================================================================
+// Go template output, for custom formatting of command results
+// e.g. one line summaries for tmux, or markdown snippets for tickets
+// =====================================================================
+
+package output
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var currentTemplate *template.Template
+
+// Colours available to the 'color' template function
+var colorStyles = map[string]Style{
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"bold":    "1",
+}
+
+// templateFuncs are the helper functions available in all templates
+var templateFuncs = template.FuncMap{
+	"formatTime": formatTime,
+	"remaining":  Remaining,
+	"color":      color,
+	"join":       strings.Join,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+}
+
+// SetTemplate parses the given Go template text and makes it the active output template
+func SetTemplate(text string) error {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	currentTemplate = tmpl
+
+	return nil
+}
+
+// SetTemplateFile reads a Go template from a file and makes it the active output template
+func SetTemplateFile(path string) error {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read template file: %w", err)
+	}
+
+	return SetTemplate(string(text))
+}
+
+// UsingTemplate returns true when an output template has been set
+func UsingTemplate() bool {
+	return currentTemplate != nil
+}
+
+// Render executes the active output template against data, writing to stdout
+func Render(data any) error {
+	if currentTemplate == nil {
+		return fmt.Errorf("no output template set")
+	}
+
+	if err := currentTemplate.Execute(os.Stdout, data); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return nil
+}
+
+// Remaining returns the time left until t in a short '2h 5m' format
+func Remaining(t time.Time) string {
+	if t.IsZero() {
+		return "N/A"
+	}
+
+	remaining := time.Until(t).Round(time.Minute)
+	h := remaining / time.Hour
+	remaining -= h * time.Hour
+	m := remaining / time.Minute
+
+	return fmt.Sprintf("%dh %dm", h, m)
+}
+
+// formatTime formats t in local time using a Go time layout, zero times are shown as 'Never'
+func formatTime(layout string, t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+
+	return t.Local().Format(layout)
+}
+
+// color renders text in the named colour, when colour output is enabled
+func color(name, text string) string {
+	return colorStyles[name].Render(text)
+}
@@ -0,0 +1,60 @@
+// ===========================================================================================
+// The Backend interface, so commands don't depend on which API is used to manage PIM groups.
+// The Azure RBAC PIM API client is the default implementation, others can be chosen at
+// runtime, e.g. fakes for testing or other APIs with the same capabilities
+// ===========================================================================================
+
+package pim
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// Names of the backends, as used in the config file
+const (
+	BackendAzureRBAC = "azrbac"
+	BackendGraph     = "graph"
+)
+
+// Backends lists the names of all the backends, the first is the default
+var Backends = []string{BackendAzureRBAC, BackendGraph}
+
+// Backend lists & makes requests for PIM group assignments on behalf of a user.
+// Implementations return errors classified with the Err* values in this package where they can
+type Backend interface {
+	// ListEligiblePIMGroups returns the group roles the user is eligible for
+	ListEligiblePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error)
+
+	// ListActivePIMGroups returns the group roles the user has activated
+	ListActivePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error)
+
+	// ListPendingPIMRequests returns the user's requests waiting for approval
+	ListPendingPIMRequests(ctx context.Context, userID string) ([]RoleAssignment, error)
+
+	// ListRequestHistory returns all the user's requests made between from and to, oldest first
+	ListRequestHistory(ctx context.Context, userID string, from, to time.Time) ([]Request, error)
+
+	// RequestPIMGroupActivation activates an eligible group role, ErrApprovalRequired is returned with the response if pending
+	RequestPIMGroupActivation(ctx context.Context, userID, groupName, reason string, duration time.Duration,
+		roleName string) (Response, error)
+
+	// RequestPIMGroupDeactivation ends an active group role before it expires
+	RequestPIMGroupDeactivation(ctx context.Context, userID, groupName, roleName string) (Response, error)
+
+	// RequestPIMGroupExtension extends an active group role to end after the given duration from now
+	RequestPIMGroupExtension(ctx context.Context, userID, groupName, reason string, duration time.Duration,
+		roleName string) (Response, error)
+
+	// RequestEligibilityRenewal asks for the user's eligibility to be extended, or renewed if it has expired
+	RequestEligibilityRenewal(ctx context.Context, userID, groupName, reason string, duration time.Duration,
+		roleName string) (Response, error)
+
+	// GetToken acquires an access token for the backend's API
+	GetToken(ctx context.Context) (azcore.AccessToken, error)
+}
+
+// Client is the Azure RBAC PIM API backend
+var _ Backend = (*Client)(nil)
@@ -0,0 +1,256 @@
+// ===========================================================================================
+// Tests for both backends, run against the fake server in the pimtest package
+// ===========================================================================================
+
+package pim_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/benc-uk/pim-cli/pkg/pimtest"
+)
+
+// forEachBackend runs a test against every backend, each with a new fake server
+func forEachBackend(t *testing.T, test func(t *testing.T, s *pimtest.Server, b pim.Backend)) {
+	t.Helper()
+
+	for _, name := range pim.Backends {
+		t.Run(name, func(t *testing.T) {
+			s := pimtest.NewServer()
+			t.Cleanup(s.Close)
+
+			test(t, s, newBackend(s, name))
+		})
+	}
+}
+
+// newBackend creates the named backend, pointed at the fake server
+func newBackend(s *pimtest.Server, name string) pim.Backend {
+	if name == pim.BackendGraph {
+		return pim.NewGraphBackend(graph.NewClient(s.Credential(), &graph.ClientOptions{Cloud: s.Cloud()}))
+	}
+
+	return pim.NewClient(s.Credential(), &pim.ClientOptions{Cloud: s.Cloud()})
+}
+
+func TestActivate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+
+		if _, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "testing", time.Hour, "Member"); err != nil {
+			t.Fatalf("activation failed: %v", err)
+		}
+
+		active, err := b.ListActivePIMGroups(ctx, s.User.ID)
+		if err != nil {
+			t.Fatalf("failed to list active groups: %v", err)
+		}
+
+		if len(active) != 1 || active[0].Resource.DisplayName != "Admins" || active[0].RoleDefinition.DisplayName != "Member" {
+			t.Fatalf("expected Admins (Member) to be active, got %+v", active)
+		}
+
+		if end := active[0].EndDateTime.Sub(s.Now()); end < 59*time.Minute || end > time.Hour {
+			t.Errorf("expected the activation to end in an hour, ends in %s", end)
+		}
+	})
+}
+
+func TestActivateNotEligible(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		_, err := b.RequestPIMGroupActivation(context.Background(), s.User.ID, "Admins", "", time.Hour, "Member")
+		if !errors.Is(err, pim.ErrNotEligible) {
+			t.Fatalf("expected ErrNotEligible, got %v", err)
+		}
+	})
+}
+
+func TestActivateAlreadyActive(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+
+		if _, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member"); err != nil {
+			t.Fatalf("activation failed: %v", err)
+		}
+
+		_, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member")
+		if !errors.Is(err, pim.ErrAlreadyActive) {
+			t.Fatalf("expected ErrAlreadyActive, got %v", err)
+		}
+	})
+}
+
+func TestActivateApproval(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+		s.RequireApproval("Admins", true)
+
+		resp, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member")
+		if !errors.Is(err, pim.ErrApprovalRequired) || !resp.Pending() {
+			t.Fatalf("expected a pending request & ErrApprovalRequired, got %+v, %v", resp, err)
+		}
+
+		pending, err := b.ListPendingPIMRequests(ctx, s.User.ID)
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("expected one pending request, got %d, %v", len(pending), err)
+		}
+
+		_, err = b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member")
+		if !errors.Is(err, pim.ErrAlreadyPending) {
+			t.Fatalf("expected ErrAlreadyPending, got %v", err)
+		}
+
+		if err := s.Approve(resp.ID); err != nil {
+			t.Fatalf("failed to approve: %v", err)
+		}
+
+		active, err := b.ListActivePIMGroups(ctx, s.User.ID)
+		if err != nil || len(active) != 1 {
+			t.Fatalf("expected the role to be active once approved, got %d, %v", len(active), err)
+		}
+	})
+}
+
+func TestExtend(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+
+		if _, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member"); err != nil {
+			t.Fatalf("activation failed: %v", err)
+		}
+
+		s.Advance(30 * time.Minute)
+
+		if _, err := b.RequestPIMGroupExtension(ctx, s.User.ID, "Admins", "", 2*time.Hour, "Member"); err != nil {
+			t.Fatalf("extension failed: %v", err)
+		}
+
+		active := s.Active()
+		if len(active) != 1 {
+			t.Fatalf("expected one active role, got %d", len(active))
+		}
+
+		if end := active[0].EndDateTime.Sub(s.Now()); end < 119*time.Minute || end > 2*time.Hour {
+			t.Errorf("expected the activation to end in two hours, ends in %s", end)
+		}
+	})
+}
+
+func TestDeactivate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+
+		if _, err := b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member"); err != nil {
+			t.Fatalf("activation failed: %v", err)
+		}
+
+		if _, err := b.RequestPIMGroupDeactivation(ctx, s.User.ID, "Admins", "Member"); err != nil {
+			t.Fatalf("deactivation failed: %v", err)
+		}
+
+		if active := s.Active(); len(active) != 0 {
+			t.Fatalf("expected no active roles, got %d", len(active))
+		}
+	})
+}
+
+func TestNotActive(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+
+		if _, err := b.RequestPIMGroupDeactivation(ctx, s.User.ID, "Admins", "Member"); !errors.Is(err, pim.ErrNotActive) {
+			t.Errorf("expected ErrNotActive deactivating, got %v", err)
+		}
+
+		if _, err := b.RequestPIMGroupExtension(ctx, s.User.ID, "Admins", "", time.Hour, "Member"); !errors.Is(err, pim.ErrNotActive) {
+			t.Errorf("expected ErrNotActive extending, got %v", err)
+		}
+	})
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault pimtest.Fault
+		check func(err error) bool
+	}{
+		{"throttled", pimtest.Throttle(""), func(err error) bool { return errors.Is(err, pim.ErrThrottled) }},
+		{"server error", pimtest.ServerError(""), func(err error) bool {
+			var pimErr *pim.PimError
+			return errors.As(err, &pimErr) && pimErr.HTTPStatusCode == 500
+		}},
+		{"malformed", pimtest.Malformed(""), func(err error) bool { return err != nil }},
+		{"slow", pimtest.Slow("", time.Second), func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+				s.AddEligible("Admins", "Member", time.Time{})
+				s.Inject(tt.fault)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+
+				if _, err := b.ListEligiblePIMGroups(ctx, s.User.ID); !tt.check(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				s.ClearFaults()
+
+				eligible, err := b.ListEligiblePIMGroups(context.Background(), s.User.ID)
+				if err != nil || len(eligible) != 1 {
+					t.Fatalf("expected to recover once the fault is cleared, got %d, %v", len(eligible), err)
+				}
+			})
+		})
+	}
+}
+
+func TestHistoryPaging(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *pimtest.Server, b pim.Backend) {
+		ctx := context.Background()
+		s.AddEligible("Admins", "Member", time.Time{})
+		s.PageSize = 2
+
+		// Activate & deactivate, ending with an activation, for five requests over three pages
+		for i := range 5 {
+			var err error
+			if i%2 == 0 {
+				_, err = b.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member")
+			} else {
+				_, err = b.RequestPIMGroupDeactivation(ctx, s.User.ID, "Admins", "Member")
+			}
+
+			if err != nil {
+				t.Fatalf("request %d failed: %v", i, err)
+			}
+		}
+
+		now := s.Now()
+
+		requests, err := b.ListRequestHistory(ctx, s.User.ID, now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("failed to list history: %v", err)
+		}
+
+		if len(requests) != 5 {
+			t.Fatalf("expected all five requests from every page, got %d", len(requests))
+		}
+
+		if activations := pim.Activations(requests, now); len(activations) != 3 {
+			t.Errorf("expected three activations, got %d", len(activations))
+		}
+	})
+}
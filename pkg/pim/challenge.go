@@ -0,0 +1,57 @@
+// ===========================================================================================
+// Claims challenges, returned when a group's PIM policy needs MFA or a Conditional Access
+// authentication context (acrs). A new token with the claims has to be got interactively
+// ===========================================================================================
+
+package pim
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Claims asked for when the policy only says MFA is required, without a full claims challenge
+const mfaClaims = `{"access_token":{"amr":{"essential":true,"values":["mfa"]}}}`
+
+// Matches the claims parameter in a WWW-Authenticate header, which is base64 encoded
+var challengeHeaderRegex = regexp.MustCompile(`claims="([^"]+)"`)
+
+// claimsChallenge finds the claims a new token needs, from the WWW-Authenticate header or the
+// error message. Empty if the response isn't a claims challenge
+func claimsChallenge(header http.Header, pimErr *PimError) string {
+	for _, h := range header.Values("WWW-Authenticate") {
+		m := challengeHeaderRegex.FindStringSubmatch(h)
+		if m == nil {
+			continue
+		}
+
+		if claims, err := base64.StdEncoding.DecodeString(m[1]); err == nil {
+			return string(claims)
+		}
+
+		if claims, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(m[1], "=")); err == nil {
+			return string(claims)
+		}
+	}
+
+	if pimErr == nil {
+		return ""
+	}
+
+	// Authentication context failures include the claims JSON in the message
+	if i := strings.Index(pimErr.ApiError.Message, `{"access_token"`); i >= 0 {
+		var claims json.RawMessage
+		if err := json.NewDecoder(strings.NewReader(pimErr.ApiError.Message[i:])).Decode(&claims); err == nil {
+			return string(claims)
+		}
+	}
+
+	if pimErr.Kind == ErrMfaRequired {
+		return mfaClaims
+	}
+
+	return ""
+}
@@ -0,0 +1,88 @@
+// ===========================================================================================
+// Eligibility expiry, and requests to extend or renew an eligible assignment before or
+// after it has ended. These requests need approval by an administrator
+// ===========================================================================================
+
+package pim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How far back the request history is searched to find an eligibility which has already expired
+const renewalLookback = 365 * 24 * time.Hour
+
+// ExpiresWithin returns true if the assignment ends within d of now, permanent assignments never expire
+func (a RoleAssignment) ExpiresWithin(d time.Duration, now time.Time) bool {
+	return !a.EndDateTime.IsZero() && a.EndDateTime.Sub(now) <= d
+}
+
+// RequestEligibilityRenewal asks for the user's eligibility for a group & role to be extended, or
+// renewed if it has already expired. Expired eligibilities are found from the user's request history
+func (c *Client) RequestEligibilityRenewal(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
+	if roleName == "" {
+		return Response{}, fmt.Errorf("role name must be specified")
+	}
+
+	if duration <= 0 {
+		return Response{}, fmt.Errorf("duration must be greater than zero")
+	}
+
+	if groupName == "" {
+		return Response{}, fmt.Errorf("group name must be specified")
+	}
+
+	if reason == "" {
+		reason = "Renewal requested via pim-cli"
+	}
+
+	now := time.Now().UTC()
+	requestBody := pimActivationRequest{
+		SubjectID:       userID,
+		AssignmentState: "Eligible",
+		Type:            RequestTypeExtend,
+		Reason:          reason,
+		Schedule: pimActivationSchedule{
+			Type:          "Once",
+			StartDateTime: now,
+			EndDateTime:   now.Add(duration),
+		},
+	}
+
+	eligible, found, err := c.findEligible(ctx, userID, groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if found {
+		requestBody.RoleDefinitionID = eligible.RoleDefinition.ID
+		requestBody.ResourceID = eligible.ResourceID
+
+		return c.submitRequest(ctx, requestBody)
+	}
+
+	// Not currently eligible, so look for a past request for the group & role to renew
+	requests, err := c.ListRequestHistory(ctx, userID, now.Add(-renewalLookback), now)
+	if err != nil {
+		return Response{}, err
+	}
+
+	for i := len(requests) - 1; i >= 0; i-- {
+		r := requests[i]
+		if r.Resource.DisplayName != groupName || !strings.EqualFold(r.RoleDefinition.DisplayName, roleName) {
+			continue
+		}
+
+		requestBody.Type = RequestTypeRenew
+		requestBody.RoleDefinitionID = r.RoleDefinition.ID
+		requestBody.ResourceID = r.ResourceID
+
+		return c.submitRequest(ctx, requestBody)
+	}
+
+	return Response{}, fmt.Errorf("%w, and no expired eligibility found for group: %s with role: %s", ErrNotEligible, groupName, roleName)
+}
@@ -0,0 +1,103 @@
+// ===========================================================================================
+// Errors returned by the PIM API, classified so callers can react to them with errors.Is
+// ===========================================================================================
+
+package pim
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benc-uk/pim-cli/pkg/trace"
+)
+
+// Classes of PIM errors, use errors.Is to check for these
+var (
+	ErrAlreadyActive    = errors.New("already active")
+	ErrAlreadyPending   = errors.New("a request is already pending")
+	ErrPolicyViolation  = errors.New("request doesn't meet the PIM policy")
+	ErrApprovalRequired = errors.New("approval required")
+	ErrMfaRequired      = errors.New("MFA or authentication context required")
+	ErrNotEligible      = errors.New("not eligible")
+	ErrNotActive        = errors.New("not active")
+	ErrThrottled        = errors.New("throttled by the PIM API")
+	ErrUnauthorized     = errors.New("not authorized by the PIM API")
+)
+
+// Error codes returned by the PIM API, mapped to the classes above
+var errorCodes = map[string]error{
+	"RoleAssignmentExists":                        ErrAlreadyActive,
+	"PendingRoleAssignmentRequest":                ErrAlreadyPending,
+	"RoleAssignmentRequestPolicyValidationFailed": ErrPolicyViolation,
+	"ActiveDurationTooShort":                      ErrPolicyViolation,
+	"RoleAssignmentDoesNotExist":                  ErrNotEligible,
+	"RoleAssignmentNotFound":                      ErrNotEligible,
+	"SubjectNotEligible":                          ErrNotEligible,
+	"TooManyRequests":                             ErrThrottled,
+	"Unauthorized":                                ErrUnauthorized,
+	"Forbidden":                                   ErrUnauthorized,
+}
+
+// Policy rules which fail when stronger authentication is needed, these are named in the error message
+var mfaRules = []string{"MfaRule", "AcrsRule"}
+
+// PimError is an error response from the PIM API
+type PimError struct {
+	HTTPStatusCode int `json:"-"`
+	ApiError       struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+
+	// Kind is the class of the error, e.g. ErrAlreadyActive, nil if not known
+	Kind error `json:"-"`
+
+	// IDs of the failed request, Microsoft support will ask for these
+	IDs trace.RequestIDs `json:"-"`
+}
+
+func (e *PimError) Error() string {
+	msg := e.ApiError.Message
+	if e.ApiError.Code != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.ApiError.Code)
+	}
+
+	if ids := e.IDs.String(); ids != "" {
+		msg += " " + ids
+	}
+
+	return msg
+}
+
+// Unwrap returns the class of the error, so errors.Is works with the sentinel errors
+func (e *PimError) Unwrap() error {
+	return e.Kind
+}
+
+// classifyError works out the class of an error from the code, falling back to the HTTP status
+func classifyError(statusCode int, code, message string) error {
+	kind := errorCodes[code]
+
+	if kind == ErrPolicyViolation || kind == nil {
+		for _, rule := range mfaRules {
+			if strings.Contains(message, rule) {
+				return ErrMfaRequired
+			}
+		}
+	}
+
+	if kind != nil {
+		return kind
+	}
+
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return ErrThrottled
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	}
+
+	return nil
+}
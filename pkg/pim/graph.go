@@ -0,0 +1,499 @@
+// ===========================================================================================
+// Backend using the Microsoft Graph PIM for Groups API, for service principals & automation
+// which have been granted PrivilegedAccess.ReadWrite.AzureADGroup. Graph's schedule instances
+// and requests are converted to the same types as the Azure RBAC PIM API returns
+// ===========================================================================================
+
+package pim
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+)
+
+// Path of the PIM for Groups API, under the Graph base URL
+const graphPIMPath = "/identityGovernance/privilegedAccess/group"
+
+// Actions of Graph schedule requests, mapped to the request types used by the PIM API
+var graphActions = map[string]string{
+	"selfActivate":   RequestTypeAdd,
+	"adminAssign":    RequestTypeAdd,
+	"selfDeactivate": RequestTypeRemove,
+	"adminRemove":    RequestTypeRemove,
+	"selfExtend":     RequestTypeExtend,
+	"adminExtend":    RequestTypeExtend,
+	"selfRenew":      RequestTypeRenew,
+	"adminRenew":     RequestTypeRenew,
+}
+
+// Statuses of Graph schedule requests, mapped to the status & sub status used by the PIM API
+var graphStatuses = map[string]RequestStatus{
+	"PendingApproval":         {Status: "Pending", SubStatus: "PendingApproval"},
+	"PendingProvisioning":     {Status: "Pending", SubStatus: "PendingProvisioning"},
+	"PendingScheduleCreation": {Status: "Pending", SubStatus: "PendingScheduleCreation"},
+	"Provisioned":             {Status: "Accepted", SubStatus: "Provisioned"},
+	"Granted":                 {Status: "Accepted", SubStatus: "Granted"},
+	"Revoked":                 {Status: "Accepted", SubStatus: "Revoked"},
+	"Denied":                  {Status: "Closed", SubStatus: "AdminDenied"},
+	"Canceled":                {Status: "Closed", SubStatus: "Canceled"},
+	"Failed":                  {Status: "Closed", SubStatus: "Failed"},
+}
+
+// GraphBackend manages PIM groups with the Microsoft Graph API
+type GraphBackend struct {
+	client *graph.Client
+}
+
+// GraphBackend is an alternative to the Azure RBAC PIM API
+var _ Backend = (*GraphBackend)(nil)
+
+// NewGraphBackend creates a backend using the given Graph client, the token it gets must have the
+// PrivilegedAccess.ReadWrite.AzureADGroup permission, which Azure CLI tokens don't
+func NewGraphBackend(client *graph.Client) *GraphBackend {
+	return &GraphBackend{client: client}
+}
+
+// ===== Graph PIM for Groups structures =====
+
+type graphGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// graphScheduleInstance is an eligibility or assignment schedule instance
+type graphScheduleInstance struct {
+	ID          string     `json:"id"`
+	AccessID    string     `json:"accessId"`
+	GroupID     string     `json:"groupId"`
+	PrincipalID string     `json:"principalId"`
+	MemberType  string     `json:"memberType"`
+	EndDateTime time.Time  `json:"endDateTime"`
+	Group       graphGroup `json:"group"`
+}
+
+// graphScheduleRequest is an eligibility or assignment schedule request, both sent & returned
+type graphScheduleRequest struct {
+	ID              string            `json:"id,omitempty"`
+	AccessID        string            `json:"accessId"`
+	GroupID         string            `json:"groupId"`
+	PrincipalID     string            `json:"principalId"`
+	Action          string            `json:"action"`
+	Justification   string            `json:"justification,omitempty"`
+	Status          string            `json:"status,omitempty"`
+	CreatedDateTime time.Time         `json:"createdDateTime,omitzero"`
+	ScheduleInfo    graphScheduleInfo `json:"scheduleInfo,omitzero"`
+	Group           graphGroup        `json:"group,omitzero"`
+}
+
+type graphScheduleInfo struct {
+	StartDateTime time.Time       `json:"startDateTime,omitzero"`
+	Expiration    graphExpiration `json:"expiration,omitzero"`
+}
+
+type graphExpiration struct {
+	Type        string    `json:"type"`
+	EndDateTime time.Time `json:"endDateTime,omitzero"`
+	Duration    string    `json:"duration,omitempty"`
+}
+
+type graphListResp[T any] struct {
+	Value    []T    `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+// ===== Backend implementation =====
+
+// ListEligiblePIMGroups returns the group roles the user is eligible for
+func (b *GraphBackend) ListEligiblePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	return b.listInstances(ctx, "eligibilityScheduleInstances", userID, "Eligible")
+}
+
+// ListActivePIMGroups returns the group roles the user has activated, or been permanently assigned
+func (b *GraphBackend) ListActivePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	return b.listInstances(ctx, "assignmentScheduleInstances", userID, "Active")
+}
+
+// ListPendingPIMRequests returns the user's activation requests waiting for approval
+func (b *GraphBackend) ListPendingPIMRequests(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	requests, err := b.listRequests(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []RoleAssignment{}
+
+	for _, r := range requests {
+		if r.Status != "PendingApproval" {
+			continue
+		}
+
+		status := graphStatuses[r.Status]
+		pending = append(pending, RoleAssignment{
+			ID:                r.ID,
+			ResourceID:        r.GroupID,
+			RoleDefinition:    graphRole(r.AccessID),
+			Resource:          graphResource(r.GroupID, r.Group),
+			AssignmentState:   "Active",
+			EndDateTime:       r.ScheduleInfo.Expiration.EndDateTime,
+			RequestedDateTime: r.CreatedDateTime,
+			Reason:            r.Justification,
+			Status:            map[string]any{"status": status.Status, "subStatus": status.SubStatus},
+		})
+	}
+
+	return pending, nil
+}
+
+// ListRequestHistory returns the user's activation requests made between from and to, oldest first
+func (b *GraphBackend) ListRequestHistory(ctx context.Context, userID string, from, to time.Time) ([]Request, error) {
+	graphRequests, err := b.listRequests(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []Request{}
+
+	for _, r := range graphRequests {
+		if r.CreatedDateTime.Before(from) || r.CreatedDateTime.After(to) {
+			continue
+		}
+
+		requests = append(requests, r.toRequest())
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedDateTime.Before(requests[j].RequestedDateTime)
+	})
+
+	return requests, nil
+}
+
+// RequestPIMGroupActivation activates an eligible group role, ErrApprovalRequired is returned with the response if pending
+func (b *GraphBackend) RequestPIMGroupActivation(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
+	if roleName == "" || groupName == "" {
+		return Response{}, fmt.Errorf("group name & role name must be specified")
+	}
+
+	if duration <= 0 {
+		return Response{}, fmt.Errorf("duration must be greater than zero")
+	}
+
+	eligible, found, err := b.find(ctx, b.ListEligiblePIMGroups, userID, groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !found {
+		return Response{}, fmt.Errorf("%w for group: %s with role: %s", ErrNotEligible, groupName, roleName)
+	}
+
+	response, err := b.submit(ctx, "assignmentScheduleRequests", graphScheduleRequest{
+		AccessID:      eligible.RoleDefinition.ID,
+		GroupID:       eligible.ResourceID,
+		PrincipalID:   userID,
+		Action:        "selfActivate",
+		Justification: cmp.Or(reason, "Requested via pim-cli"),
+		ScheduleInfo:  afterDuration(duration),
+	})
+	if err == nil && response.Pending() {
+		return response, ErrApprovalRequired
+	}
+
+	return response, err
+}
+
+// RequestPIMGroupDeactivation ends an active group role before it expires
+func (b *GraphBackend) RequestPIMGroupDeactivation(ctx context.Context, userID, groupName, roleName string) (Response, error) {
+	active, found, err := b.find(ctx, b.ListActivePIMGroups, userID, groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !found {
+		return Response{}, fmt.Errorf("%w, no active assignment for group: %s with role: %s", ErrNotActive, groupName, roleName)
+	}
+
+	return b.submit(ctx, "assignmentScheduleRequests", graphScheduleRequest{
+		AccessID:    active.RoleDefinition.ID,
+		GroupID:     active.ResourceID,
+		PrincipalID: userID,
+		Action:      "selfDeactivate",
+	})
+}
+
+// RequestPIMGroupExtension extends an active group role to end after the given duration from now
+func (b *GraphBackend) RequestPIMGroupExtension(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
+	if duration <= 0 {
+		return Response{}, fmt.Errorf("duration must be greater than zero")
+	}
+
+	active, found, err := b.find(ctx, b.ListActivePIMGroups, userID, groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !found {
+		return Response{}, fmt.Errorf("%w, no active assignment for group: %s with role: %s", ErrNotActive, groupName, roleName)
+	}
+
+	response, err := b.submit(ctx, "assignmentScheduleRequests", graphScheduleRequest{
+		AccessID:      active.RoleDefinition.ID,
+		GroupID:       active.ResourceID,
+		PrincipalID:   userID,
+		Action:        "selfExtend",
+		Justification: cmp.Or(reason, "Extension requested via pim-cli"),
+		ScheduleInfo:  afterDuration(duration),
+	})
+	if err == nil && response.Pending() {
+		return response, ErrApprovalRequired
+	}
+
+	return response, err
+}
+
+// RequestEligibilityRenewal asks for the user's eligibility to be extended, or renewed if it has expired.
+// Expired eligibilities are found from the user's activation history
+func (b *GraphBackend) RequestEligibilityRenewal(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
+	if roleName == "" || groupName == "" {
+		return Response{}, fmt.Errorf("group name & role name must be specified")
+	}
+
+	if duration <= 0 {
+		return Response{}, fmt.Errorf("duration must be greater than zero")
+	}
+
+	now := time.Now().UTC()
+	body := graphScheduleRequest{
+		PrincipalID:   userID,
+		Action:        "selfExtend",
+		Justification: cmp.Or(reason, "Renewal requested via pim-cli"),
+		ScheduleInfo: graphScheduleInfo{
+			StartDateTime: now,
+			Expiration:    graphExpiration{Type: "afterDateTime", EndDateTime: now.Add(duration)},
+		},
+	}
+
+	eligible, found, err := b.find(ctx, b.ListEligiblePIMGroups, userID, groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if found {
+		body.AccessID, body.GroupID = eligible.RoleDefinition.ID, eligible.ResourceID
+
+		return b.submit(ctx, "eligibilityScheduleRequests", body)
+	}
+
+	requests, err := b.ListRequestHistory(ctx, userID, now.Add(-renewalLookback), now)
+	if err != nil {
+		return Response{}, err
+	}
+
+	for i := len(requests) - 1; i >= 0; i-- {
+		r := requests[i]
+		if r.Resource.DisplayName != groupName || !strings.EqualFold(r.RoleDefinition.DisplayName, roleName) {
+			continue
+		}
+
+		body.Action, body.AccessID, body.GroupID = "selfRenew", r.RoleDefinitionID, r.ResourceID
+
+		return b.submit(ctx, "eligibilityScheduleRequests", body)
+	}
+
+	return Response{}, fmt.Errorf("%w, and no expired eligibility found for group: %s with role: %s", ErrNotEligible, groupName, roleName)
+}
+
+// GetToken acquires an access token for the Microsoft Graph API
+func (b *GraphBackend) GetToken(ctx context.Context) (azcore.AccessToken, error) {
+	return b.client.GetToken(ctx)
+}
+
+// ===== Internal helper functions =====
+
+// listInstances fetches the user's eligibility or assignment schedule instances, as role assignments in the given state
+func (b *GraphBackend) listInstances(ctx context.Context, kind, userID, state string) ([]RoleAssignment, error) {
+	instances, err := graphList[graphScheduleInstance](ctx, b, kind, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := []RoleAssignment{}
+
+	for _, i := range instances {
+		assignments = append(assignments, RoleAssignment{
+			ID:              i.ID,
+			ResourceID:      i.GroupID,
+			RoleDefinition:  graphRole(i.AccessID),
+			Resource:        graphResource(i.GroupID, i.Group),
+			AssignmentState: state,
+			MemberType:      titleCase(i.MemberType),
+			EndDateTime:     i.EndDateTime,
+			Status:          "Provisioned",
+		})
+	}
+
+	return assignments, nil
+}
+
+// listRequests fetches all of the user's assignment schedule requests
+func (b *GraphBackend) listRequests(ctx context.Context, userID string) ([]graphScheduleRequest, error) {
+	return graphList[graphScheduleRequest](ctx, b, "assignmentScheduleRequests", userID)
+}
+
+// graphList fetches everything of a kind for the user, with the group expanded, following paging
+func graphList[T any](ctx context.Context, b *GraphBackend, kind, userID string) ([]T, error) {
+	filter := fmt.Sprintf("principalId eq '%s'", userID)
+	reqURL := fmt.Sprintf("%s%s/%s?$filter=%s&$expand=group", b.client.BaseURL(), graphPIMPath, kind, url.QueryEscape(filter))
+
+	items := []T{}
+
+	for page := 0; reqURL != ""; page++ {
+		if page >= maxHistoryPages {
+			return nil, fmt.Errorf("%s has more than %d pages", kind, maxHistoryPages)
+		}
+
+		var resp graphListResp[T]
+		if err := b.client.Request(ctx, http.MethodGet, reqURL, nil, &resp); err != nil {
+			return nil, graphPIMError(err)
+		}
+
+		items = append(items, resp.Value...)
+		reqURL = resp.NextLink
+	}
+
+	return items, nil
+}
+
+// find finds the user's assignment for a group & role from a listing, found is false if there isn't one
+func (b *GraphBackend) find(ctx context.Context, list func(context.Context, string) ([]RoleAssignment, error),
+	userID, groupName, roleName string) (RoleAssignment, bool, error) {
+	assignments, err := list(ctx, userID)
+	if err != nil {
+		return RoleAssignment{}, false, err
+	}
+
+	for _, a := range assignments {
+		if a.Resource.DisplayName == groupName && strings.EqualFold(a.RoleDefinition.DisplayName, roleName) {
+			return a, true, nil
+		}
+	}
+
+	return RoleAssignment{}, false, nil
+}
+
+// submit posts a schedule request, returning the response in the same form as the PIM API
+func (b *GraphBackend) submit(ctx context.Context, kind string, body graphScheduleRequest) (Response, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to marshal schedule request body: %w", err)
+	}
+
+	var result graphScheduleRequest
+	if err := b.client.Request(ctx, http.MethodPost, b.client.BaseURL()+graphPIMPath+"/"+kind, bodyBytes, &result); err != nil {
+		return Response{}, graphPIMError(err)
+	}
+
+	r := result.toRequest()
+
+	var response Response
+	response.ID = r.ID
+	response.Status.Status = r.Status.Status
+	response.Status.SubStatus = r.Status.SubStatus
+	response.RoleAssignmentEndDateTime = r.RoleAssignmentEndDateTime
+
+	return response, nil
+}
+
+// toRequest converts a Graph schedule request to a PIM API request
+func (r graphScheduleRequest) toRequest() Request {
+	status, ok := graphStatuses[r.Status]
+	if !ok {
+		status = RequestStatus{Status: r.Status, SubStatus: r.Status}
+	}
+
+	req := Request{
+		ID:                r.ID,
+		ResourceID:        r.GroupID,
+		RoleDefinitionID:  r.AccessID,
+		Resource:          graphResource(r.GroupID, r.Group),
+		RoleDefinition:    graphRole(r.AccessID),
+		Type:              cmp.Or(graphActions[r.Action], r.Action),
+		AssignmentState:   "Active",
+		Reason:            r.Justification,
+		RequestedDateTime: r.CreatedDateTime,
+		Schedule: RequestSchedule{
+			Type:          "Once",
+			StartDateTime: r.ScheduleInfo.StartDateTime,
+			EndDateTime:   r.ScheduleInfo.Expiration.EndDateTime,
+			Duration:      r.ScheduleInfo.Expiration.Duration,
+		},
+		Status: status,
+	}
+
+	if req.Granted() {
+		req.RoleAssignmentStartDateTime = firstNonZero(r.ScheduleInfo.StartDateTime, r.CreatedDateTime)
+		req.RoleAssignmentEndDateTime = r.ScheduleInfo.Expiration.EndDateTime
+
+		if d := req.RequestedDuration(); req.RoleAssignmentEndDateTime.IsZero() && d > 0 {
+			req.RoleAssignmentEndDateTime = req.RoleAssignmentStartDateTime.Add(d)
+		}
+	}
+
+	return req
+}
+
+// graphPIMError converts a Graph API error to a PIM error, so it's classified the same way
+func graphPIMError(err error) error {
+	var graphErr *graph.Error
+	if !errors.As(err, &graphErr) {
+		return err
+	}
+
+	pimErr := &PimError{HTTPStatusCode: graphErr.StatusCode, IDs: graphErr.IDs}
+	pimErr.ApiError.Code = graphErr.Code
+	pimErr.ApiError.Message = graphErr.Message
+	pimErr.Kind = classifyError(graphErr.StatusCode, graphErr.Code, graphErr.Message)
+
+	return pimErr
+}
+
+// afterDuration is a schedule starting now and lasting for the duration
+func afterDuration(d time.Duration) graphScheduleInfo {
+	return graphScheduleInfo{
+		StartDateTime: time.Now().UTC(),
+		Expiration:    graphExpiration{Type: "afterDuration", Duration: isoDuration(d)},
+	}
+}
+
+// graphRole returns the role for a Graph access ID, which is the role name in lower case, e.g. member
+func graphRole(accessID string) RoleDefinition {
+	return RoleDefinition{ID: accessID, DisplayName: titleCase(accessID)}
+}
+
+// graphResource returns the group, Graph only includes its name when expanded
+func graphResource(groupID string, group graphGroup) Resource {
+	return Resource{ID: groupID, DisplayName: cmp.Or(group.DisplayName, groupID), Type: "Group"}
+}
+
+// titleCase upper cases the first letter, Graph uses camel case where the PIM API uses Pascal case
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
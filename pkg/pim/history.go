@@ -0,0 +1,263 @@
+// ===========================================================================================
+// Request history from the Azure RBAC PIM API, and working out what was actually activated
+// for how long, used for compliance reports & usage analysis
+// ===========================================================================================
+
+package pim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request types, as used by the PIM API
+const (
+	RequestTypeAdd    = "UserAdd"
+	RequestTypeRemove = "UserRemove"
+	RequestTypeExtend = "UserExtend"
+	RequestTypeRenew  = "UserRenew"
+)
+
+// Safety limit on the number of pages fetched for the request history
+const maxHistoryPages = 100
+
+// Request is a role assignment request from the user's history, e.g. an activation or deactivation
+type Request struct {
+	ID                          string          `json:"id"`
+	ResourceID                  string          `json:"resourceId"`
+	RoleDefinitionID            string          `json:"roleDefinitionId"`
+	Resource                    Resource        `json:"resource"`
+	RoleDefinition              RoleDefinition  `json:"roleDefinition"`
+	Type                        string          `json:"type"`
+	AssignmentState             string          `json:"assignmentState"`
+	Reason                      string          `json:"reason"`
+	RequestedDateTime           time.Time       `json:"requestedDateTime"`
+	Schedule                    RequestSchedule `json:"schedule"`
+	Status                      RequestStatus   `json:"status"`
+	RoleAssignmentStartDateTime time.Time       `json:"roleAssignmentStartDateTime"`
+	RoleAssignmentEndDateTime   time.Time       `json:"roleAssignmentEndDateTime"`
+}
+
+// RequestSchedule is the requested start & duration of an assignment
+type RequestSchedule struct {
+	Type          string    `json:"type"`
+	StartDateTime time.Time `json:"startDateTime"`
+	EndDateTime   time.Time `json:"endDateTime"`
+	Duration      string    `json:"duration"`
+}
+
+// RequestStatus is the outcome of a request
+type RequestStatus struct {
+	Status    string `json:"status"`
+	SubStatus string `json:"subStatus"`
+}
+
+// Activation is a granted activation worked out from the request history
+type Activation struct {
+	Request Request
+	Start   time.Time
+	End     time.Time
+	// Requested is how long the activation was asked for
+	Requested time.Duration
+	// Actual is how long the activation really lasted, shorter if deactivated early
+	Actual time.Duration
+	// EndedEarly is true when the user deactivated before the activation expired
+	EndedEarly bool
+	// Ongoing is true when the activation hasn't ended yet
+	Ongoing bool
+}
+
+type pimRequestResp struct {
+	Value    []Request `json:"value"`
+	NextLink string    `json:"@odata.nextLink"`
+}
+
+// Sub statuses which mean a request was granted
+var grantedSubStatuses = map[string]bool{
+	"Provisioned":   true,
+	"Granted":       true,
+	"AdminApproved": true,
+}
+
+// Matches ISO 8601 durations as used by the API, e.g. PT8H or P1DT30M
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// Granted returns true if the request was granted
+func (r Request) Granted() bool {
+	return grantedSubStatuses[r.Status.SubStatus]
+}
+
+// RequestedDuration returns the duration that was asked for in the request
+func (r Request) RequestedDuration() time.Duration {
+	if d, err := ParseISODuration(r.Schedule.Duration); err == nil && d > 0 {
+		return d
+	}
+
+	if !r.Schedule.EndDateTime.IsZero() && !r.Schedule.StartDateTime.IsZero() {
+		return r.Schedule.EndDateTime.Sub(r.Schedule.StartDateTime)
+	}
+
+	return 0
+}
+
+// ListRequestHistory fetches all of the user's requests made between from and to, following paging
+func (c *Client) ListRequestHistory(ctx context.Context, userID string, from, to time.Time) ([]Request, error) {
+	// The API is fussy about filtering on dates, so we filter by user and then by date here
+	filter := fmt.Sprintf("subjectId eq '%s'", userID)
+	reqURL := fmt.Sprintf("%s/roleAssignmentRequests?$filter=%s&$expand=resource,roleDefinition",
+		c.baseURL, url.QueryEscape(filter))
+
+	requests := []Request{}
+
+	for page := 0; reqURL != ""; page++ {
+		if page >= maxHistoryPages {
+			return nil, fmt.Errorf("request history has more than %d pages, try a shorter period", maxHistoryPages)
+		}
+
+		var pimResp pimRequestResp
+		if err := c.pimAPIRequest(ctx, http.MethodGet, reqURL, nil, &pimResp); err != nil {
+			return nil, err
+		}
+
+		for _, r := range pimResp.Value {
+			if r.RequestedDateTime.Before(from) || r.RequestedDateTime.After(to) {
+				continue
+			}
+
+			requests = append(requests, r)
+		}
+
+		reqURL = pimResp.NextLink
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedDateTime.Before(requests[j].RequestedDateTime)
+	})
+
+	return requests, nil
+}
+
+// Activations works out the granted activations from a request history, and how long each one
+// actually lasted, taking into account any extensions & deactivations. Requests must be sorted oldest first.
+// An extension moves the end of the activation it extends, only extensions of an activation from
+// before the history starts are counted as activations of their own
+func Activations(requests []Request, now time.Time) []Activation {
+	activations := []Activation{}
+
+	// Index of the request each activation came from, to search for deactivations after it
+	from := []int{}
+
+	for i, r := range requests {
+		if r.AssignmentState != "Active" || (r.Type != RequestTypeAdd && r.Type != RequestTypeExtend) || !r.Granted() {
+			continue
+		}
+
+		start := firstNonZero(r.RoleAssignmentStartDateTime, r.Schedule.StartDateTime, r.RequestedDateTime)
+		end := r.RoleAssignmentEndDateTime
+
+		if requested := r.RequestedDuration(); end.IsZero() && requested > 0 {
+			end = start.Add(requested)
+		}
+
+		if r.Type == RequestTypeExtend {
+			if j := latestActivation(activations, r, start); j >= 0 {
+				activations[j].End = end
+				activations[j].Requested = end.Sub(activations[j].Start)
+
+				continue
+			}
+		}
+
+		activations = append(activations, Activation{Request: r, Start: start, End: end, Requested: r.RequestedDuration()})
+		from = append(from, i)
+	}
+
+	for n := range activations {
+		a := &activations[n]
+		r := a.Request
+
+		// Look for a later deactivation of the same group & role, before this one expired
+		for _, later := range requests[from[n]+1:] {
+			if later.Type != RequestTypeRemove || later.ResourceID != r.ResourceID || later.RoleDefinition.ID != r.RoleDefinition.ID {
+				continue
+			}
+
+			if later.RequestedDateTime.After(a.Start) && (a.End.IsZero() || later.RequestedDateTime.Before(a.End)) {
+				a.End = later.RequestedDateTime
+				a.EndedEarly = true
+
+				break
+			}
+		}
+
+		if a.End.IsZero() || a.End.After(now) {
+			a.End = now
+			a.Ongoing = true
+		}
+
+		a.Actual = a.End.Sub(a.Start)
+	}
+
+	return activations
+}
+
+// latestActivation returns the index of the latest activation of the same group & role as an
+// extension, which started before it, -1 if there isn't one
+func latestActivation(activations []Activation, extension Request, before time.Time) int {
+	for j := len(activations) - 1; j >= 0; j-- {
+		a := activations[j]
+		if a.Request.ResourceID == extension.ResourceID && a.Request.RoleDefinition.ID == extension.RoleDefinition.ID &&
+			!a.Start.After(before) {
+			return j
+		}
+	}
+
+	return -1
+}
+
+// ParseISODuration parses the subset of ISO 8601 durations used by the PIM API, e.g. PT720M or P1DT2H
+func ParseISODuration(s string) (time.Duration, error) {
+	normalised := strings.ToUpper(strings.TrimSpace(s))
+
+	m := isoDurationRegex.FindStringSubmatch(normalised)
+	if m == nil || normalised == "P" || normalised == "PT" {
+		return 0, fmt.Errorf("invalid ISO 8601 duration: %q", s)
+	}
+
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	var d time.Duration
+
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration: %q", s)
+		}
+
+		d += time.Duration(n * float64(unit))
+	}
+
+	return d, nil
+}
+
+// firstNonZero returns the first of the times that is set
+func firstNonZero(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
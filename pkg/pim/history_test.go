@@ -0,0 +1,181 @@
+// ===========================================================================================
+// Tests for working out activations from the request history
+// ===========================================================================================
+
+package pim_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "PT720M", want: 12 * time.Hour},
+		{in: "PT8H", want: 8 * time.Hour},
+		{in: "P1DT2H", want: 26 * time.Hour},
+		{in: "P1D", want: 24 * time.Hour},
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "PT1.5S", want: 1500 * time.Millisecond},
+		{in: "pt30m", want: 30 * time.Minute},
+		{in: " PT1H ", want: time.Hour},
+		{in: "", wantErr: true},
+		{in: "P", wantErr: true},
+		{in: "PT", wantErr: true},
+		{in: "pt", wantErr: true},
+		{in: " PT", wantErr: true},
+		{in: "P ", wantErr: true},
+		{in: "1H", wantErr: true},
+		{in: "PT1X", wantErr: true},
+		{in: "PT-1H", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := pim.ParseISODuration(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %s, got %s, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// historyStart is when the test request histories start
+var historyStart = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// request returns a granted request for Admins (Member), made the given time after historyStart
+func request(reqType string, after, duration time.Duration) pim.Request {
+	r := pim.Request{
+		ResourceID:        "admins",
+		RoleDefinition:    pim.RoleDefinition{ID: "member", DisplayName: "Member"},
+		Type:              reqType,
+		AssignmentState:   "Active",
+		RequestedDateTime: historyStart.Add(after),
+		Status:            pim.RequestStatus{Status: "Accepted", SubStatus: "Provisioned"},
+	}
+
+	if duration > 0 {
+		r.Schedule.Duration = fmt.Sprintf("PT%dM", int(duration.Minutes()))
+	}
+
+	return r
+}
+
+func TestActivations(t *testing.T) {
+	denied := request(pim.RequestTypeAdd, 0, time.Hour)
+	denied.Status = pim.RequestStatus{Status: "Closed", SubStatus: "AdminDenied"}
+
+	tests := []struct {
+		name     string
+		requests []pim.Request
+		now      time.Duration
+		want     []pim.Activation
+	}{
+		{
+			name:     "expired",
+			requests: []pim.Request{request(pim.RequestTypeAdd, 0, time.Hour)},
+			now:      24 * time.Hour,
+			want:     []pim.Activation{{Requested: time.Hour, Actual: time.Hour}},
+		},
+		{
+			name:     "ongoing",
+			requests: []pim.Request{request(pim.RequestTypeAdd, 0, time.Hour)},
+			now:      20 * time.Minute,
+			want:     []pim.Activation{{Requested: time.Hour, Actual: 20 * time.Minute, Ongoing: true}},
+		},
+		{
+			name: "deactivated early",
+			requests: []pim.Request{
+				request(pim.RequestTypeAdd, 0, time.Hour),
+				request(pim.RequestTypeRemove, 15*time.Minute, 0),
+			},
+			now:  24 * time.Hour,
+			want: []pim.Activation{{Requested: time.Hour, Actual: 15 * time.Minute, EndedEarly: true}},
+		},
+		{
+			name: "deactivated after expiry is ignored",
+			requests: []pim.Request{
+				request(pim.RequestTypeAdd, 0, time.Hour),
+				request(pim.RequestTypeRemove, 2*time.Hour, 0),
+			},
+			now:  24 * time.Hour,
+			want: []pim.Activation{{Requested: time.Hour, Actual: time.Hour}},
+		},
+		{
+			name: "extension merged",
+			requests: []pim.Request{
+				request(pim.RequestTypeAdd, 0, time.Hour),
+				request(pim.RequestTypeExtend, 30*time.Minute, 2*time.Hour),
+			},
+			now:  24 * time.Hour,
+			want: []pim.Activation{{Requested: 150 * time.Minute, Actual: 150 * time.Minute}},
+		},
+		{
+			name: "extension merged then deactivated",
+			requests: []pim.Request{
+				request(pim.RequestTypeAdd, 0, time.Hour),
+				request(pim.RequestTypeExtend, 30*time.Minute, 2*time.Hour),
+				request(pim.RequestTypeRemove, 90*time.Minute, 0),
+			},
+			now:  24 * time.Hour,
+			want: []pim.Activation{{Requested: 150 * time.Minute, Actual: 90 * time.Minute, EndedEarly: true}},
+		},
+		{
+			name:     "extension of an activation before the history",
+			requests: []pim.Request{request(pim.RequestTypeExtend, 0, time.Hour)},
+			now:      24 * time.Hour,
+			want:     []pim.Activation{{Requested: time.Hour, Actual: time.Hour}},
+		},
+		{
+			name: "separate activations",
+			requests: []pim.Request{
+				request(pim.RequestTypeAdd, 0, time.Hour),
+				request(pim.RequestTypeRemove, 10*time.Minute, 0),
+				request(pim.RequestTypeAdd, 2*time.Hour, time.Hour),
+			},
+			now: 24 * time.Hour,
+			want: []pim.Activation{
+				{Requested: time.Hour, Actual: 10 * time.Minute, EndedEarly: true},
+				{Requested: time.Hour, Actual: time.Hour},
+			},
+		},
+		{
+			name:     "not granted",
+			requests: []pim.Request{denied},
+			now:      24 * time.Hour,
+			want:     []pim.Activation{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pim.Activations(tt.requests, historyStart.Add(tt.now))
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d activation(s), got %d", len(tt.want), len(got))
+			}
+
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Requested != want.Requested || g.Actual != want.Actual || g.EndedEarly != want.EndedEarly || g.Ongoing != want.Ongoing {
+					t.Errorf("activation %d: expected requested %s, actual %s, early %t, ongoing %t, got %s, %s, %t, %t", i,
+						want.Requested, want.Actual, want.EndedEarly, want.Ongoing, g.Requested, g.Actual, g.EndedEarly, g.Ongoing)
+				}
+			}
+		})
+	}
+}
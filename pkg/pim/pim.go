@@ -5,14 +5,17 @@
 // Why not use Microsoft Graph API? Because it requires permissions not available via
 // Azure CLI authentication (e.g. PrivilegedAccess.ReadWrite.AzureADGroup)
 // And various other reasons that make it impractical for any real world usage.
+// Service principals which have been granted the permission can use the Graph backend instead
 // ===========================================================================================
 
 package pim
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,39 +25,104 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+	"github.com/benc-uk/pim-cli/pkg/trace"
 )
 
-const (
-	pimAPIScope   = "https://api.azrbac.mspim.azure.com/.default"
-	pimAPIBaseURL = "https://api.azrbac.mspim.azure.com/api/v2/privilegedAccess/aadGroups"
-)
+// Path of the PIM for Groups API, under the cloud's PIM endpoint
+const pimAPIPath = "/api/v2/privilegedAccess/aadGroups"
+
+// Client for the Azure RBAC PIM API, with Azure authentication
+type Client struct {
+	cred            azcore.TokenCredential
+	httpClient      *http.Client
+	scope           string
+	baseURL         string
+	userAgent       string
+	claimsChallenge func(claims string) (azcore.TokenCredential, error)
+}
+
+// ClientOptions configures a PIM API client
+type ClientOptions struct {
+	// Cloud sets the PIM endpoint to use, defaults to the public cloud
+	Cloud cloud.Cloud
+
+	// HTTPClient is used for all requests, defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	// UserAgent is sent with all requests, defaults to pim-cli
+	UserAgent string
+
+	// ClaimsChallenge is called when the API needs a token with extra claims, e.g. for MFA. It returns
+	// a credential able to get such a token, usually interactively. Nil means the error is returned
+	ClaimsChallenge func(claims string) (azcore.TokenCredential, error)
+}
+
+// NewClient creates a new PIM API client with the given Azure credential, options can be nil
+func NewClient(cred azcore.TokenCredential, opts *ClientOptions) *Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	endpoint := strings.TrimSuffix(cloud.Public.WithOverrides(opts.Cloud).PIMEndpoint, "/")
+
+	return &Client{
+		cred:            cred,
+		httpClient:      httpClient,
+		scope:           endpoint + "/.default",
+		baseURL:         endpoint + pimAPIPath,
+		userAgent:       cmp.Or(opts.UserAgent, "pim-cli"),
+		claimsChallenge: opts.ClaimsChallenge,
+	}
+}
 
 // ===== Role assignment structures for PIM API ======
 
-type pimRoleAssignment struct {
-	ID                string            `json:"id"`
-	ResourceID        string            `json:"resourceId"`
-	RoleDefinition    pimRoleDefinition `json:"roleDefinition"`
-	Resource          pimResource       `json:"resource"`
-	AssignmentState   string            `json:"assignmentState"`
-	MemberType        string            `json:"memberType"`
-	EndDateTime       time.Time         `json:"endDateTime"`
-	RequestedDateTime time.Time         `json:"requestedDateTime"`
-	Reason            string            `json:"reason"`
-	Status            any               `json:"status"`
+// RoleAssignment is an eligible or active group role assignment, or an assignment request
+type RoleAssignment struct {
+	ID                string         `json:"id"`
+	ResourceID        string         `json:"resourceId"`
+	RoleDefinition    RoleDefinition `json:"roleDefinition"`
+	Resource          Resource       `json:"resource"`
+	AssignmentState   string         `json:"assignmentState"`
+	MemberType        string         `json:"memberType"`
+	EndDateTime       time.Time      `json:"endDateTime"`
+	RequestedDateTime time.Time      `json:"requestedDateTime"`
+	Reason            string         `json:"reason"`
+	Status            any            `json:"status"`
 }
 
-type pimResource struct {
+// Resource is the PIM group an assignment is for
+type Resource struct {
 	ID          string `json:"id"`
 	DisplayName string `json:"displayName"`
 	Type        string `json:"type"`
 }
 
-type pimRoleDefinition struct {
+// RoleDefinition is the group role (e.g. Member or Owner) an assignment is for
+type RoleDefinition struct {
 	ID          string `json:"id"`
 	DisplayName string `json:"displayName"`
 }
 
+// StatusText returns the assignment status as a readable string.
+// The API returns status as a mix of types, so we need to assert it down to something useful
+func (a RoleAssignment) StatusText() string {
+	switch status := a.Status.(type) {
+	case string:
+		return status
+	case map[string]any:
+		return strings.TrimSpace(fmt.Sprintf("%v %v", status["status"], status["subStatus"]))
+	}
+
+	return "Unknown"
+}
+
 // ===== Role assignment request structures for PIM API ======
 
 type pimActivationRequest struct {
@@ -76,7 +144,9 @@ type pimActivationSchedule struct {
 
 // ===== PIM API response structures ======
 
-type pimActivationResponse struct {
+// Response is the API's answer to a role assignment request
+type Response struct {
+	ID     string `json:"id"`
 	Status struct {
 		Status    string `json:"status"`
 		SubStatus string `json:"subStatus"`
@@ -84,30 +154,20 @@ type pimActivationResponse struct {
 	RoleAssignmentEndDateTime time.Time `json:"roleAssignmentEndDateTime"`
 }
 
-type pimRoleAssignmentResp struct {
-	Value []pimRoleAssignment `json:"value"`
+// Pending returns true if the request is waiting for approval
+func (r Response) Pending() bool {
+	return r.Status.SubStatus == "PendingApproval"
 }
 
-// ===== PIM API custom error structure =====
-
-type PimError struct {
-	HTTPStatusCode int `json:"-"`
-	ApiError       struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
-}
-
-func (e *PimError) Error() string {
-	// TBH the code never very useful, so just return the message
-	return e.ApiError.Message
+type pimRoleAssignmentResp struct {
+	Value []RoleAssignment `json:"value"`
 }
 
 // ===== Public PIM API functions =====
 
 // ListEligiblePIMGroups queries and displays all PIM groups the user is eligible for using Azure RBAC PIM API
-func ListEligiblePIMGroups(ctx context.Context, cred azcore.TokenCredential, userID string) ([]pimRoleAssignment, error) {
-	assignments, err := getRoleAssignments(ctx, cred, userID, "Eligible")
+func (c *Client) ListEligiblePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	assignments, err := c.getRoleAssignments(ctx, userID, "Eligible")
 	if err != nil {
 		return nil, err
 	}
@@ -116,8 +176,8 @@ func ListEligiblePIMGroups(ctx context.Context, cred azcore.TokenCredential, use
 }
 
 // ListActivePIMGroups queries and displays all PIM groups the user has currently activated using Azure RBAC PIM API
-func ListActivePIMGroups(ctx context.Context, cred azcore.TokenCredential, userID string) ([]pimRoleAssignment, error) {
-	assignments, err := getRoleAssignments(ctx, cred, userID, "Active")
+func (c *Client) ListActivePIMGroups(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	assignments, err := c.getRoleAssignments(ctx, userID, "Active")
 	if err != nil {
 		return nil, err
 	}
@@ -126,8 +186,8 @@ func ListActivePIMGroups(ctx context.Context, cred azcore.TokenCredential, userI
 }
 
 // ListPendingPIMRequests queries and displays all pending PIM group activation requests for the user
-func ListPendingPIMRequests(ctx context.Context, cred azcore.TokenCredential, userID string) ([]pimRoleAssignment, error) {
-	assignments, err := getRoleAssignmentRequests(ctx, cred, userID, "PendingApproval")
+func (c *Client) ListPendingPIMRequests(ctx context.Context, userID string) ([]RoleAssignment, error) {
+	assignments, err := c.getRoleAssignmentRequests(ctx, userID, "PendingApproval")
 	if err != nil {
 		return nil, err
 	}
@@ -135,44 +195,32 @@ func ListPendingPIMRequests(ctx context.Context, cred azcore.TokenCredential, us
 	return assignments, nil
 }
 
-// RequestPIMGroupActivation requests activation for a PIM group using Azure RBAC PIM API
-func RequestPIMGroupActivation(ctx context.Context, cred azcore.TokenCredential, userID,
-	groupName, reason string, duration time.Duration, roleName string) (pimActivationResponse, error) {
+// RequestPIMGroupActivation requests activation for a PIM group using Azure RBAC PIM API.
+// When the group needs approval the request is still made, and ErrApprovalRequired is returned with the response
+func (c *Client) RequestPIMGroupActivation(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
 	if roleName == "" {
-		return pimActivationResponse{}, fmt.Errorf("role name must be specified")
+		return Response{}, fmt.Errorf("role name must be specified")
 	}
 
 	if duration <= 0 {
-		return pimActivationResponse{}, fmt.Errorf("duration must be greater than zero")
+		return Response{}, fmt.Errorf("duration must be greater than zero")
 	}
 
 	if groupName == "" {
-		return pimActivationResponse{}, fmt.Errorf("group name must be specified")
+		return Response{}, fmt.Errorf("group name must be specified")
 	}
 
 	// First, find the eligible role assignment for the specified group
-	assignments, err := getRoleAssignments(ctx, cred, userID, "Eligible")
+	targetAssignment, found, err := c.findEligible(ctx, userID, groupName, roleName)
 	if err != nil {
-		return pimActivationResponse{}, err
+		return Response{}, err
 	}
 
-	var targetAssignment *pimRoleAssignment
-
-	for _, assignment := range assignments {
-		if assignment.Resource.DisplayName == groupName && strings.EqualFold(assignment.RoleDefinition.DisplayName, roleName) {
-			targetAssignment = &assignment
-			break
-		}
-	}
-
-	if targetAssignment == nil {
-		return pimActivationResponse{}, fmt.Errorf("no eligible group found: %s with role: %s", groupName, roleName)
+	if !found {
+		return Response{}, fmt.Errorf("%w for group: %s with role: %s", ErrNotEligible, groupName, roleName)
 	}
 
-	// Convert duration to ISO 8601 duration format (e.g., PT720M for 720 minutes)
-	durationMinutes := int(duration.Minutes())
-	isoDuration := fmt.Sprintf("PT%dM", durationMinutes)
-
 	if reason == "" {
 		reason = "Requested via pim-cli"
 	}
@@ -183,45 +231,158 @@ func RequestPIMGroupActivation(ctx context.Context, cred azcore.TokenCredential,
 		ResourceID:       targetAssignment.ResourceID,
 		SubjectID:        userID,
 		AssignmentState:  "Active",
-		Type:             "UserAdd",
+		Type:             RequestTypeAdd,
 		Reason:           reason,
 		Schedule: pimActivationSchedule{
 			Type:          "Once",
 			StartDateTime: nil,
 			EndDateTime:   nil,
-			Duration:      isoDuration,
+			Duration:      isoDuration(duration),
 		},
 	}
 
+	response, err := c.submitRequest(ctx, requestBody)
+	if err == nil && response.Pending() {
+		return response, ErrApprovalRequired
+	}
+
+	return response, err
+}
+
+// RequestPIMGroupDeactivation ends the user's activation of a group & role before it expires
+func (c *Client) RequestPIMGroupDeactivation(ctx context.Context, userID, groupName, roleName string) (Response, error) {
+	if groupName == "" || roleName == "" {
+		return Response{}, fmt.Errorf("group name & role name must be specified")
+	}
+
+	active, found, err := c.findAssignment(ctx, userID, "Active", groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !found {
+		return Response{}, fmt.Errorf("%w, no active assignment for group: %s with role: %s", ErrNotActive, groupName, roleName)
+	}
+
+	return c.submitRequest(ctx, pimActivationRequest{
+		RoleDefinitionID: active.RoleDefinition.ID,
+		ResourceID:       active.ResourceID,
+		SubjectID:        userID,
+		AssignmentState:  "Active",
+		Type:             RequestTypeRemove,
+		Schedule:         pimActivationSchedule{Type: "Once"},
+	})
+}
+
+// RequestPIMGroupExtension extends the user's activation of a group & role, so it ends after duration from now
+func (c *Client) RequestPIMGroupExtension(ctx context.Context, userID,
+	groupName, reason string, duration time.Duration, roleName string) (Response, error) {
+	if groupName == "" || roleName == "" {
+		return Response{}, fmt.Errorf("group name & role name must be specified")
+	}
+
+	if duration <= 0 {
+		return Response{}, fmt.Errorf("duration must be greater than zero")
+	}
+
+	active, found, err := c.findAssignment(ctx, userID, "Active", groupName, roleName)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !found {
+		return Response{}, fmt.Errorf("%w, no active assignment for group: %s with role: %s", ErrNotActive, groupName, roleName)
+	}
+
+	if reason == "" {
+		reason = "Extension requested via pim-cli"
+	}
+
+	response, err := c.submitRequest(ctx, pimActivationRequest{
+		RoleDefinitionID: active.RoleDefinition.ID,
+		ResourceID:       active.ResourceID,
+		SubjectID:        userID,
+		AssignmentState:  "Active",
+		Type:             RequestTypeExtend,
+		Reason:           reason,
+		Schedule:         pimActivationSchedule{Type: "Once", Duration: isoDuration(duration)},
+	})
+	if err == nil && response.Pending() {
+		return response, ErrApprovalRequired
+	}
+
+	return response, err
+}
+
+// GetToken acquires an access token for the PIM API
+func (c *Client) GetToken(ctx context.Context) (azcore.AccessToken, error) {
+	token, err := c.cred.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes: []string{c.scope},
+	})
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to get PIM API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ====== Internal helper functions ======
+
+// findEligible finds the user's eligible assignment for a group & role, found is false if there isn't one
+func (c *Client) findEligible(ctx context.Context, userID, groupName, roleName string) (RoleAssignment, bool, error) {
+	return c.findAssignment(ctx, userID, "Eligible", groupName, roleName)
+}
+
+// findAssignment finds the user's assignment in the given state for a group & role, found is false if there isn't one
+func (c *Client) findAssignment(ctx context.Context, userID, state, groupName, roleName string) (RoleAssignment, bool, error) {
+	assignments, err := c.getRoleAssignments(ctx, userID, state)
+	if err != nil {
+		return RoleAssignment{}, false, err
+	}
+
+	for _, assignment := range assignments {
+		if assignment.Resource.DisplayName == groupName && strings.EqualFold(assignment.RoleDefinition.DisplayName, roleName) {
+			return assignment, true, nil
+		}
+	}
+
+	return RoleAssignment{}, false, nil
+}
+
+// submitRequest posts a role assignment request to the PIM API
+func (c *Client) submitRequest(ctx context.Context, requestBody pimActivationRequest) (Response, error) {
 	bodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
-		return pimActivationResponse{}, fmt.Errorf("failed to marshal activation request body: %w", err)
+		return Response{}, fmt.Errorf("failed to marshal activation request body: %w", err)
 	}
 
-	activationURL := fmt.Sprintf("%s/roleAssignmentRequests", pimAPIBaseURL)
+	requestURL := fmt.Sprintf("%s/roleAssignmentRequests", c.baseURL)
 
-	var response pimActivationResponse
-	if err := pimAPIRequest(ctx, cred, http.MethodPost, activationURL, bodyBytes, &response); err != nil {
-		return pimActivationResponse{}, err
+	var response Response
+	if err := c.pimAPIRequest(ctx, http.MethodPost, requestURL, bodyBytes, &response); err != nil {
+		return Response{}, err
 	}
 
 	return response, nil
 }
 
-// ====== Internal helper functions ======
+// isoDuration converts a duration to ISO 8601 duration format (e.g., PT720M for 720 minutes)
+func isoDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dM", int(d.Minutes()))
+}
 
 // getRoleAssignments fetches role assignments for a user with the given filter
-func getRoleAssignments(ctx context.Context, cred azcore.TokenCredential, userID, assignmentState string) ([]pimRoleAssignment, error) {
+func (c *Client) getRoleAssignments(ctx context.Context, userID, assignmentState string) ([]RoleAssignment, error) {
 	filter := fmt.Sprintf("subjectId eq '%s'", userID)
 	if assignmentState != "" {
 		filter += fmt.Sprintf(" and assignmentState eq '%s'", assignmentState)
 	}
 
 	reqURL := fmt.Sprintf("%s/roleAssignments?$filter=%s&$expand=resource,roleDefinition",
-		pimAPIBaseURL, url.QueryEscape(filter))
+		c.baseURL, url.QueryEscape(filter))
 
 	var pimResp pimRoleAssignmentResp
-	if err := pimAPIRequest(ctx, cred, http.MethodGet, reqURL, nil, &pimResp); err != nil {
+	if err := c.pimAPIRequest(ctx, http.MethodGet, reqURL, nil, &pimResp); err != nil {
 		return nil, err
 	}
 
@@ -229,32 +390,67 @@ func getRoleAssignments(ctx context.Context, cred azcore.TokenCredential, userID
 }
 
 // getRoleAssignmentRequests fetches role assignment requests for a user with the given status filter
-func getRoleAssignmentRequests(ctx context.Context, cred azcore.TokenCredential, userID, status string) ([]pimRoleAssignment, error) {
+func (c *Client) getRoleAssignmentRequests(ctx context.Context, userID, status string) ([]RoleAssignment, error) {
 	filter := fmt.Sprintf("subjectId eq '%s'", userID)
 	if status != "" {
 		filter += fmt.Sprintf(" and status/subStatus eq '%s'", status)
 	}
 
 	reqURL := fmt.Sprintf("%s/roleAssignmentRequests?$filter=%s&$expand=resource,roleDefinition",
-		pimAPIBaseURL, url.QueryEscape(filter))
+		c.baseURL, url.QueryEscape(filter))
 
 	var pimResp pimRoleAssignmentResp
-	if err := pimAPIRequest(ctx, cred, http.MethodGet, reqURL, nil, &pimResp); err != nil {
+	if err := c.pimAPIRequest(ctx, http.MethodGet, reqURL, nil, &pimResp); err != nil {
 		return nil, err
 	}
 
 	return pimResp.Value, nil
 }
 
-// pimAPIRequest performs an authenticated request to the PIM API and decodes the response
-func pimAPIRequest(ctx context.Context, cred azcore.TokenCredential, method, url string, body []byte, result any) error {
-	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{pimAPIScope},
+// pimAPIRequest performs an authenticated request to the PIM API and decodes the response.
+// If the API answers with a claims challenge, a new token with the claims is got and the request retried once
+func (c *Client) pimAPIRequest(ctx context.Context, method, url string, body []byte, result any) error {
+	token, err := c.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.doRequest(ctx, method, url, body, result, token.Token)
+
+	var challenge *claimsChallengeError
+	if !errors.As(err, &challenge) || c.claimsChallenge == nil {
+		return err
+	}
+
+	cred, credErr := c.claimsChallenge(challenge.claims)
+	if credErr != nil {
+		return fmt.Errorf("%w, and a token with the required claims couldn't be got: %w", err, credErr)
+	}
+
+	token, err = cred.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes:    []string{c.scope},
+		Claims:    challenge.claims,
+		EnableCAE: true,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to get PIM API token: %w", err)
+		return fmt.Errorf("failed to get PIM API token with the required claims: %w", err)
 	}
 
+	return c.doRequest(ctx, method, url, body, result, token.Token)
+}
+
+// claimsChallengeError is returned by doRequest when the API needs a token with extra claims
+type claimsChallengeError struct {
+	*PimError
+	claims string
+}
+
+func (e *claimsChallengeError) Unwrap() error {
+	return e.PimError
+}
+
+// doRequest performs a single request to the PIM API with the given token, and decodes the response
+func (c *Client) doRequest(ctx context.Context, method, url string, body []byte, result any, token string) error {
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
@@ -265,10 +461,11 @@ func pimAPIRequest(ctx context.Context, cred azcore.TokenCredential, method, url
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
+	trace.SetHeaders(req, c.userAgent)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to query PIM API: %w", err)
 	}
@@ -277,19 +474,24 @@ func pimAPIRequest(ctx context.Context, cred azcore.TokenCredential, method, url
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// Try return a nice error
+		// Try return a nice error, otherwise a generic one, either way with the IDs for support cases
 		var pimErr PimError
 
-		err := json.Unmarshal(respBody, &pimErr)
-		if err == nil && pimErr.ApiError.Message != "" {
-			pimErr.HTTPStatusCode = resp.StatusCode
-			return &pimErr
+		if err := json.Unmarshal(respBody, &pimErr); err != nil || pimErr.ApiError.Message == "" {
+			pimErr = PimError{}
+			pimErr.ApiError.Message = fmt.Sprintf("PIM API error: %s - %s", resp.Status, strings.TrimSpace(string(respBody)))
 		}
 
-		// Generic error
-		respBodyStr := strings.TrimSpace(string(respBody))
+		pimErr.HTTPStatusCode = resp.StatusCode
+		pimErr.IDs = trace.IDsFromResponse(resp)
+		pimErr.Kind = classifyError(resp.StatusCode, pimErr.ApiError.Code, pimErr.ApiError.Message)
+
+		if claims := claimsChallenge(resp.Header, &pimErr); claims != "" {
+			pimErr.Kind = ErrMfaRequired
+			return &claimsChallengeError{PimError: &pimErr, claims: claims}
+		}
 
-		return fmt.Errorf("PIM API error: %s - %s", resp.Status, respBodyStr)
+		return &pimErr
 	}
 
 	// We're really in the shit
@@ -0,0 +1,58 @@
+// ===========================================================================================
+// An in-memory fake of the Azure RBAC PIM API and the Microsoft Graph endpoints we use
+//
+// credential.go: A static token credential, with the claims of the fake server's user
+// ===========================================================================================
+
+package pimtest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// How long tokens from a static credential are valid for
+const tokenLifetime = time.Hour
+
+// StaticCredential is a credential which always returns the same token, whatever is asked for
+type StaticCredential struct {
+	Token string
+}
+
+// GetToken implements azcore.TokenCredential
+func (c StaticCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: c.Token, ExpiresOn: time.Now().Add(tokenLifetime)}, nil
+}
+
+// Credential returns a credential with a token for the server's user & tenant. The token is an unsigned
+// JWT, the fake server doesn't check it, but it has the claims the CLI reads to identify the user
+func (s *Server) Credential() StaticCredential {
+	return StaticCredential{Token: NewToken(map[string]any{
+		"oid":   s.User.ID,
+		"tid":   s.TenantID,
+		"name":  s.User.DisplayName,
+		"upn":   s.User.UserPrincipalName,
+		"scp":   "openid profile User.Read",
+		"amr":   []string{"pwd", "mfa"},
+		"aud":   s.URL,
+		"iss":   "https://sts.windows.net/" + s.TenantID + "/",
+		"exp":   time.Now().Add(tokenLifetime).Unix(),
+		"ver":   "1.0",
+		"appid": "pimtest",
+	})}
+}
+
+// NewToken returns an unsigned JWT with the given claims, for use with StaticCredential
+func NewToken(claims map[string]any) string {
+	enc := base64.RawURLEncoding
+
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(payload) + "." + enc.EncodeToString([]byte("unsigned"))
+}
@@ -0,0 +1,151 @@
+// ===========================================================================================
+// An in-memory fake of the Azure RBAC PIM API and the Microsoft Graph endpoints we use
+//
+// faults.go: Injecting faults, to check clients cope with a misbehaving API
+// ===========================================================================================
+
+package pimtest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault changes how the server responds to matching requests
+type Fault struct {
+	// Path only applies the fault to requests whose path contains this, empty means all requests
+	Path string
+
+	// Delay is how long to wait before responding, the request is cancelled if the client gives up first
+	Delay time.Duration
+
+	// Status is the HTTP status to respond with, zero means the request is handled as normal after any delay
+	Status int
+
+	// Code & Message are the error in the response body, defaults are used if empty
+	Code    string
+	Message string
+
+	// Malformed responds with a 200 and a body which isn't valid JSON, rather than Status
+	Malformed bool
+
+	// Header is added to the response, e.g. Retry-After or WWW-Authenticate
+	Header http.Header
+
+	// Times is how many requests the fault applies to, zero means all of them until cleared
+	Times int
+}
+
+// Throttle returns a fault responding with 429 Too Many Requests, asking the client to retry after a second
+func Throttle(path string) Fault {
+	return Fault{
+		Path:    path,
+		Status:  http.StatusTooManyRequests,
+		Code:    "TooManyRequests",
+		Message: "Too many requests, please retry later",
+		Header:  http.Header{"Retry-After": []string{"1"}},
+	}
+}
+
+// ServerError returns a fault responding with 500 Internal Server Error
+func ServerError(path string) Fault {
+	return Fault{Path: path, Status: http.StatusInternalServerError, Code: "InternalServerError", Message: "An unexpected error occurred"}
+}
+
+// Malformed returns a fault responding with a body which isn't valid JSON
+func Malformed(path string) Fault {
+	return Fault{Path: path, Malformed: true}
+}
+
+// Slow returns a fault which delays responses, but otherwise handles them as normal
+func Slow(path string, delay time.Duration) Fault {
+	return Fault{Path: path, Delay: delay}
+}
+
+// Inject adds a fault, faults are checked in the order they were added and only the first match is applied
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults, so the server responds normally again
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// applyFault applies the first fault matching the request, returning true if the response has been written
+func (s *Server) applyFault(w http.ResponseWriter, r *http.Request) bool {
+	f := s.matchFault(r)
+	if f == nil {
+		return false
+	}
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	for name, values := range f.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+
+	switch {
+	case f.Malformed:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"value": [{"id": "truncated`))
+
+		return true
+	case f.Status != 0:
+		code := f.Code
+		if code == "" {
+			code = strings.ReplaceAll(http.StatusText(f.Status), " ", "")
+		}
+
+		message := f.Message
+		if message == "" {
+			message = "Injected fault: " + strconv.Itoa(f.Status) + " " + http.StatusText(f.Status)
+		}
+
+		writeError(w, f.Status, code, message)
+
+		return true
+	}
+
+	return false
+}
+
+// matchFault finds the first fault for the request, using up one of its times
+func (s *Server) matchFault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if !strings.Contains(r.URL.Path, f.Path) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+
+		return f
+	}
+
+	return nil
+}
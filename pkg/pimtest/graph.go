@@ -0,0 +1,251 @@
+// ===========================================================================================
+// An in-memory fake of the Azure RBAC PIM API and the Microsoft Graph endpoints we use
+//
+// graph.go: The Graph PIM for Groups endpoints, sharing state with the PIM API so either
+// backend can be used against the same server
+// ===========================================================================================
+
+package pimtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/google/uuid"
+)
+
+// Path of the Graph PIM for Groups API, under the versioned Graph base URL
+const graphPIMPath = "/identityGovernance/privilegedAccess/group"
+
+// Graph request actions, mapped to the PIM API request type & assignment state
+var graphActions = map[string]struct{ reqType, state string }{
+	"assignment/selfActivate":   {pim.RequestTypeAdd, "Active"},
+	"assignment/selfDeactivate": {pim.RequestTypeRemove, "Active"},
+	"assignment/selfExtend":     {pim.RequestTypeExtend, "Active"},
+	"eligibility/selfExtend":    {pim.RequestTypeExtend, "Eligible"},
+	"eligibility/selfRenew":     {pim.RequestTypeRenew, "Eligible"},
+}
+
+// PIM API sub statuses, mapped to Graph request statuses
+var graphStatuses = map[string]string{
+	"PendingApproval": "PendingApproval",
+	"Provisioned":     "Provisioned",
+	"AdminApproved":   "Provisioned",
+	"Revoked":         "Revoked",
+	"AdminDenied":     "Denied",
+}
+
+type graphGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+type graphInstance struct {
+	ID          string     `json:"id"`
+	AccessID    string     `json:"accessId"`
+	GroupID     string     `json:"groupId"`
+	PrincipalID string     `json:"principalId"`
+	MemberType  string     `json:"memberType"`
+	EndDateTime *time.Time `json:"endDateTime"`
+	Group       graphGroup `json:"group"`
+}
+
+type graphRequest struct {
+	ID              string     `json:"id"`
+	AccessID        string     `json:"accessId"`
+	GroupID         string     `json:"groupId"`
+	PrincipalID     string     `json:"principalId"`
+	Action          string     `json:"action"`
+	Justification   string     `json:"justification"`
+	Status          string     `json:"status"`
+	CreatedDateTime time.Time  `json:"createdDateTime"`
+	ScheduleInfo    graphSched `json:"scheduleInfo"`
+	Group           graphGroup `json:"group"`
+}
+
+type graphSched struct {
+	StartDateTime *time.Time `json:"startDateTime"`
+	Expiration    struct {
+		Type        string     `json:"type"`
+		EndDateTime *time.Time `json:"endDateTime"`
+		Duration    string     `json:"duration"`
+	} `json:"expiration"`
+}
+
+// addGraphRoutes adds the Graph PIM for Groups endpoints to the mux
+func (s *Server) addGraphRoutes(mux *http.ServeMux) {
+	base := "/{version}" + graphPIMPath
+
+	mux.HandleFunc("GET "+base+"/eligibilityScheduleInstances", s.listGraphInstances(func() []pim.RoleAssignment { return s.eligible }))
+	mux.HandleFunc("GET "+base+"/assignmentScheduleInstances", s.listGraphInstances(func() []pim.RoleAssignment { return s.active }))
+	mux.HandleFunc("GET "+base+"/assignmentScheduleRequests", s.listGraphRequests)
+	mux.HandleFunc("POST "+base+"/assignmentScheduleRequests", s.submitGraphRequest("assignment"))
+	mux.HandleFunc("POST "+base+"/eligibilityScheduleRequests", s.submitGraphRequest("eligibility"))
+}
+
+// listGraphInstances returns the user's eligibility or assignment schedule instances
+func (s *Server) listGraphInstances(assignments func() []pim.RoleAssignment) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := parseFilter(r)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.expire()
+
+		instances := []graphInstance{}
+
+		for _, a := range assignments() {
+			if filter["principalId"] != s.User.ID {
+				break
+			}
+
+			instances = append(instances, graphInstance{
+				ID:          a.ID,
+				AccessID:    strings.ToLower(a.RoleDefinition.DisplayName),
+				GroupID:     a.ResourceID,
+				PrincipalID: s.User.ID,
+				MemberType:  strings.ToLower(a.MemberType),
+				EndDateTime: timePtr(a.EndDateTime),
+				Group:       graphGroup{ID: a.Resource.ID, DisplayName: a.Resource.DisplayName},
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"value": instances})
+	}
+}
+
+// listGraphRequests returns the user's assignment schedule requests, split into pages if set
+func (s *Server) listGraphRequests(w http.ResponseWriter, r *http.Request) {
+	filter := parseFilter(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []graphRequest{}
+
+	for _, req := range s.requests {
+		if filter["principalId"] != s.User.ID {
+			break
+		}
+
+		if req.AssignmentState == "Active" {
+			requests = append(requests, s.toGraphRequest(req, ""))
+		}
+	}
+
+	writePage(s, w, r, requests)
+}
+
+// submitGraphRequest handles an assignment or eligibility schedule request, using the same rules as the PIM API
+func (s *Server) submitGraphRequest(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body graphRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "BadRequest", "The request body is not valid: "+err.Error())
+			return
+		}
+
+		action, ok := graphActions[kind+"/"+body.Action]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", "Action "+body.Action+" is not supported")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.expire()
+
+		if body.PrincipalID != s.User.ID {
+			writeError(w, http.StatusForbidden, "Forbidden", "Requests can only be made for the signed in principal")
+			return
+		}
+
+		req := pim.Request{
+			ResourceID:        body.GroupID,
+			RoleDefinitionID:  s.roles[body.GroupID+"/"+strings.ToLower(body.AccessID)].ID,
+			Type:              action.reqType,
+			AssignmentState:   action.state,
+			Reason:            body.Justification,
+			RequestedDateTime: s.now(),
+			Schedule: pim.RequestSchedule{
+				Type:     "Once",
+				Duration: body.ScheduleInfo.Expiration.Duration,
+			},
+		}
+
+		if body.ScheduleInfo.StartDateTime != nil {
+			req.Schedule.StartDateTime = *body.ScheduleInfo.StartDateTime
+		}
+
+		if body.ScheduleInfo.Expiration.EndDateTime != nil {
+			req.Schedule.EndDateTime = *body.ScheduleInfo.Expiration.EndDateTime
+		}
+
+		req.Resource, req.RoleDefinition = s.lookup(req.ResourceID, req.RoleDefinitionID)
+		if req.Resource.ID == "" || req.RoleDefinition.ID == "" {
+			writeError(w, http.StatusBadRequest, "RoleAssignmentDoesNotExist", "The group or access ID does not exist")
+			return
+		}
+
+		if status, code, msg := s.process(&req); status != http.StatusCreated {
+			writeError(w, status, code, msg)
+			return
+		}
+
+		req.ID = uuid.NewString()
+		s.requests = append(s.requests, req)
+		writeJSON(w, http.StatusCreated, s.toGraphRequest(req, body.Action))
+	}
+}
+
+// toGraphRequest converts a request to its Graph form, the action is worked out from the type if not given
+func (s *Server) toGraphRequest(req pim.Request, action string) graphRequest {
+	if action == "" {
+		for name, a := range graphActions {
+			if strings.HasPrefix(name, "assignment/self") && a.reqType == req.Type && a.state == req.AssignmentState {
+				action = strings.TrimPrefix(name, "assignment/")
+			}
+		}
+	}
+
+	g := graphRequest{
+		ID:              req.ID,
+		AccessID:        strings.ToLower(req.RoleDefinition.DisplayName),
+		GroupID:         req.ResourceID,
+		PrincipalID:     s.User.ID,
+		Action:          action,
+		Justification:   req.Reason,
+		Status:          graphStatuses[req.Status.SubStatus],
+		CreatedDateTime: req.RequestedDateTime,
+		Group:           graphGroup{ID: req.Resource.ID, DisplayName: req.Resource.DisplayName},
+	}
+
+	g.ScheduleInfo.StartDateTime = timePtr(req.Schedule.StartDateTime)
+	if !req.RoleAssignmentStartDateTime.IsZero() {
+		g.ScheduleInfo.StartDateTime = timePtr(req.RoleAssignmentStartDateTime)
+	}
+
+	g.ScheduleInfo.Expiration.Duration = req.Schedule.Duration
+	g.ScheduleInfo.Expiration.EndDateTime = timePtr(req.Schedule.EndDateTime)
+	g.ScheduleInfo.Expiration.Type = "afterDuration"
+
+	if req.Schedule.Duration == "" {
+		g.ScheduleInfo.Expiration.Type = "afterDateTime"
+	}
+
+	return g
+}
+
+// timePtr returns nil for a zero time, which Graph sends as null
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
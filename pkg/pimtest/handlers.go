@@ -0,0 +1,307 @@
+// ===========================================================================================
+// An in-memory fake of the Azure RBAC PIM API and the Microsoft Graph endpoints we use
+//
+// handlers.go: HTTP handlers for the PIM & Graph endpoints
+// ===========================================================================================
+
+package pimtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/benc-uk/pim-cli/pkg/trace"
+	"github.com/google/uuid"
+)
+
+// Path of the PIM for Groups API, the same as used by the pim package
+const pimAPIPath = "/api/v2/privilegedAccess/aadGroups"
+
+// Matches the conditions of the $filter parameter we support, e.g. subjectId eq 'abc'
+var filterRegex = regexp.MustCompile(`([\w/]+) eq '([^']*)'`)
+
+// submittedRequest is the body of a role assignment request
+type submittedRequest struct {
+	pim.Request
+	SubjectID string `json:"subjectId"`
+}
+
+// handler routes requests to the PIM & Graph handlers, after any faults and the auth check
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+pimAPIPath+"/roleAssignments", s.listAssignments)
+	mux.HandleFunc("GET "+pimAPIPath+"/roleAssignmentRequests", s.listRequests)
+	mux.HandleFunc("POST "+pimAPIPath+"/roleAssignmentRequests", s.submitRequest)
+	mux.HandleFunc("GET /{version}/me", s.getMe)
+	mux.HandleFunc("GET /{version}/organization", s.getOrganization)
+	s.addGraphRoutes(mux)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo the IDs like the real APIs, so they show up in errors & traces
+		w.Header().Set("request-id", uuid.NewString())
+		w.Header().Set(trace.ClientRequestIDHeader, r.Header.Get(trace.ClientRequestIDHeader))
+
+		if s.applyFault(w, r) {
+			return
+		}
+
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || token == "" {
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "No bearer token was sent")
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// listAssignments returns the user's eligible and/or active assignments
+func (s *Server) listAssignments(w http.ResponseWriter, r *http.Request) {
+	filter := parseFilter(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	assignments := []pim.RoleAssignment{}
+	if filter["subjectId"] == s.User.ID {
+		switch filter["assignmentState"] {
+		case "Eligible":
+			assignments = append(assignments, s.eligible...)
+		case "Active":
+			assignments = append(assignments, s.active...)
+		case "":
+			assignments = append(append(assignments, s.eligible...), s.active...)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"value": assignments})
+}
+
+// listRequests returns the user's requests, optionally filtered by sub status, split into pages if set
+func (s *Server) listRequests(w http.ResponseWriter, r *http.Request) {
+	filter := parseFilter(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []pim.Request{}
+
+	for _, req := range s.requests {
+		if filter["subjectId"] != s.User.ID {
+			break
+		}
+
+		if subStatus := filter["status/subStatus"]; subStatus == "" || req.Status.SubStatus == subStatus {
+			requests = append(requests, req)
+		}
+	}
+
+	writePage(s, w, r, requests)
+}
+
+// submitRequest handles a role assignment request, moving the assignments to their new state
+func (s *Server) submitRequest(w http.ResponseWriter, r *http.Request) {
+	var body submittedRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "The request body is not valid: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	if body.SubjectID != s.User.ID {
+		writeError(w, http.StatusForbidden, "Forbidden", "Requests can only be made for the signed in user")
+		return
+	}
+
+	req := body.Request
+	req.ID = uuid.NewString()
+	req.RequestedDateTime = s.now()
+	req.Resource, req.RoleDefinition = s.lookup(req.ResourceID, req.RoleDefinitionID)
+
+	if req.Resource.ID == "" || req.RoleDefinition.ID == "" {
+		writeError(w, http.StatusBadRequest, "RoleAssignmentDoesNotExist", "The group or role does not exist")
+		return
+	}
+
+	if status, code, msg := s.process(&req); status != http.StatusCreated {
+		writeError(w, status, code, msg)
+		return
+	}
+
+	s.requests = append(s.requests, req)
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// process validates a request and applies it, returning the HTTP status & error to send if it fails
+func (s *Server) process(req *pim.Request) (int, string, string) {
+	eligible := find(s.eligible, req.ResourceID, req.RoleDefinitionID)
+	active := find(s.active, req.ResourceID, req.RoleDefinitionID)
+
+	switch {
+	case req.AssignmentState == "Active" && req.Type == pim.RequestTypeAdd:
+		if eligible < 0 {
+			return http.StatusBadRequest, "RoleAssignmentDoesNotExist", "The user is not eligible for the role"
+		}
+
+		if active >= 0 {
+			return http.StatusBadRequest, "RoleAssignmentExists", "The Role assignment already exists."
+		}
+
+		if s.hasPending(req.ResourceID, req.RoleDefinitionID) {
+			return http.StatusBadRequest, "PendingRoleAssignmentRequest", "There is already a pending request for the role"
+		}
+
+		if d, err := pim.ParseISODuration(req.Schedule.Duration); err != nil || d <= 0 {
+			return http.StatusBadRequest, "ActiveDurationTooShort", "The requested duration is not valid"
+		}
+
+		if s.approval[req.ResourceID] {
+			req.Status = pim.RequestStatus{Status: "Pending", SubStatus: "PendingApproval"}
+		} else {
+			s.grant(req, "Provisioned")
+		}
+
+	case req.AssignmentState == "Active" && req.Type == pim.RequestTypeRemove:
+		if active < 0 {
+			return http.StatusBadRequest, "RoleAssignmentDoesNotExist", "The role is not active"
+		}
+
+		s.active = append(s.active[:active], s.active[active+1:]...)
+		req.Status = pim.RequestStatus{Status: "Accepted", SubStatus: "Revoked"}
+
+	case req.AssignmentState == "Active" && req.Type == pim.RequestTypeExtend:
+		d, err := pim.ParseISODuration(req.Schedule.Duration)
+		if active < 0 || err != nil || d <= 0 {
+			return http.StatusBadRequest, "RoleAssignmentDoesNotExist", "The role is not active, or the duration is not valid"
+		}
+
+		s.active[active].EndDateTime = s.now().Add(d)
+		req.RoleAssignmentEndDateTime = s.active[active].EndDateTime
+		req.Status = pim.RequestStatus{Status: "Accepted", SubStatus: "Provisioned"}
+
+	case req.AssignmentState == "Eligible" && (req.Type == pim.RequestTypeExtend || req.Type == pim.RequestTypeRenew):
+		if req.Type == pim.RequestTypeExtend && eligible < 0 {
+			return http.StatusBadRequest, "RoleAssignmentDoesNotExist", "There is no eligibility to extend"
+		}
+
+		// Changes to eligibility always need an administrator to approve them
+		req.Status = pim.RequestStatus{Status: "Pending", SubStatus: "PendingApproval"}
+
+	default:
+		return http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Request type %s for %s assignments is not supported",
+			req.Type, req.AssignmentState)
+	}
+
+	return http.StatusCreated, "", ""
+}
+
+// getMe returns the signed in user
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.User)
+}
+
+// getOrganization returns the tenant
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"value": []map[string]string{{"id": s.TenantID, "displayName": s.TenantName}},
+	})
+}
+
+// ===== Helpers, those using state must be called with the lock held =====
+
+// lookup finds a group & role by ID, either is empty if not found
+func (s *Server) lookup(resourceID, roleID string) (pim.Resource, pim.RoleDefinition) {
+	var (
+		group pim.Resource
+		role  pim.RoleDefinition
+	)
+
+	for _, g := range s.groups {
+		if g.ID == resourceID {
+			group = g
+		}
+	}
+
+	for key, r := range s.roles {
+		if r.ID == roleID && strings.HasPrefix(key, resourceID+"/") {
+			role = r
+		}
+	}
+
+	return group, role
+}
+
+// hasPending returns true if there's a request for the group & role waiting for approval
+func (s *Server) hasPending(resourceID, roleID string) bool {
+	for _, r := range s.requests {
+		if r.ResourceID == resourceID && r.RoleDefinitionID == roleID && r.Status.SubStatus == "PendingApproval" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// find returns the index of the assignment for a group & role, -1 if there isn't one
+func find(assignments []pim.RoleAssignment, resourceID, roleID string) int {
+	for i, a := range assignments {
+		if a.ResourceID == resourceID && a.RoleDefinition.ID == roleID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// parseFilter returns the conditions in the $filter parameter, keyed by property
+func parseFilter(r *http.Request) map[string]string {
+	filter := map[string]string{}
+
+	for _, m := range filterRegex.FindAllStringSubmatch(r.URL.Query().Get("$filter"), -1) {
+		filter[m[1]] = m[2]
+	}
+
+	return filter
+}
+
+// writePage writes a listing, split into pages linked with @odata.nextLink if the server's page size is set
+func writePage[T any](s *Server, w http.ResponseWriter, r *http.Request, items []T) {
+	resp := map[string]any{"value": items}
+
+	if s.PageSize > 0 {
+		skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+		skip = min(max(skip, 0), len(items))
+		end := min(skip+s.PageSize, len(items))
+		resp["value"] = items[skip:end]
+
+		if end < len(items) {
+			query := r.URL.Query()
+			query.Set("$skip", strconv.Itoa(end))
+			resp["@odata.nextLink"] = s.URL + r.URL.Path + "?" + query.Encode()
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error in the format used by both the PIM & Graph APIs
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
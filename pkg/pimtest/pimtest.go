@@ -0,0 +1,286 @@
+// ===========================================================================================
+// An in-memory fake of the Azure RBAC PIM API and the Microsoft Graph endpoints we use,
+// served with httptest, so the clients & commands can be run without a real tenant.
+// Requests move through realistic states (pending approval, provisioned, expired), and
+// faults such as throttling, server errors, malformed JSON and slow responses can be injected
+// ===========================================================================================
+
+package pimtest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/cloud"
+	"github.com/benc-uk/pim-cli/pkg/graph"
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/google/uuid"
+)
+
+// Server is a fake PIM & Graph API server, for a single signed in user.
+// Use Cloud() to point the clients at it, and Credential() to authenticate with it
+type Server struct {
+	*httptest.Server
+
+	// User is returned by Graph /me, the ID is the subject of all assignments
+	User graph.User
+
+	// TenantID & TenantName are put in tokens and returned by Graph /organization
+	TenantID   string
+	TenantName string
+
+	// PageSize splits request listings into pages linked with @odata.nextLink, zero means no paging
+	PageSize int
+
+	mu       sync.Mutex
+	offset   time.Duration
+	groups   map[string]pim.Resource
+	roles    map[string]pim.RoleDefinition
+	approval map[string]bool
+	eligible []pim.RoleAssignment
+	active   []pim.RoleAssignment
+	requests []pim.Request
+	faults   []*Fault
+}
+
+// NewServer starts a fake server with a test user & tenant and no assignments, call Close when done
+func NewServer() *Server {
+	s := &Server{
+		User: graph.User{
+			ID:                uuid.NewString(),
+			DisplayName:       "Test User",
+			UserPrincipalName: "test.user@contoso.example",
+			Mail:              "test.user@contoso.example",
+			GivenName:         "Test",
+			Surname:           "User",
+			AccountEnabled:    true,
+		},
+		TenantID:   uuid.NewString(),
+		TenantName: "Contoso Test",
+		groups:     map[string]pim.Resource{},
+		roles:      map[string]pim.RoleDefinition{},
+		approval:   map[string]bool{},
+	}
+
+	s.Server = httptest.NewServer(s.handler())
+
+	return s
+}
+
+// Cloud returns endpoints which send both PIM & Graph requests to the fake server.
+// Sign in isn't faked, so use Credential() rather than a real credential
+func (s *Server) Cloud() cloud.Cloud {
+	return cloud.Cloud{GraphEndpoint: s.URL, PIMEndpoint: s.URL}
+}
+
+// Now returns the current time of the fake server, which can be moved on with Advance
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now()
+}
+
+// Advance moves the fake server's clock on, so activations & eligibility can be made to expire
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset += d
+}
+
+// AddEligible makes the user eligible for a role in a group, creating the group if needed.
+// A zero end time means the eligibility is permanent
+func (s *Server) AddEligible(groupName, roleName string, end time.Time) pim.RoleAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group := s.group(groupName)
+	assignment := pim.RoleAssignment{
+		ID:              uuid.NewString(),
+		ResourceID:      group.ID,
+		RoleDefinition:  s.role(group, roleName),
+		Resource:        group,
+		AssignmentState: "Eligible",
+		MemberType:      "Direct",
+		EndDateTime:     end,
+		Status:          "Provisioned",
+	}
+
+	s.eligible = append(s.eligible, assignment)
+
+	return assignment
+}
+
+// RequireApproval sets whether activating roles in a group must be approved, see Approve & Deny
+func (s *Server) RequireApproval(groupName string, required bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.approval[s.group(groupName).ID] = required
+}
+
+// Approve approves a request which is pending approval, activating the role, or for
+// eligibility requests, extending or renewing the eligibility until the end of the schedule
+func (s *Server) Approve(requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.pendingRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	if r.AssignmentState != "Eligible" {
+		s.grant(r, "AdminApproved")
+		return nil
+	}
+
+	r.Status = pim.RequestStatus{Status: "Accepted", SubStatus: "AdminApproved"}
+
+	if i := find(s.eligible, r.ResourceID, r.RoleDefinitionID); i >= 0 {
+		s.eligible[i].EndDateTime = r.Schedule.EndDateTime
+		return nil
+	}
+
+	s.eligible = append(s.eligible, pim.RoleAssignment{
+		ID:              uuid.NewString(),
+		ResourceID:      r.ResourceID,
+		RoleDefinition:  r.RoleDefinition,
+		Resource:        r.Resource,
+		AssignmentState: "Eligible",
+		MemberType:      "Direct",
+		EndDateTime:     r.Schedule.EndDateTime,
+		Status:          "Provisioned",
+	})
+
+	return nil
+}
+
+// Deny denies a request which is pending approval
+func (s *Server) Deny(requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.pendingRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	r.Status = pim.RequestStatus{Status: "Closed", SubStatus: "AdminDenied"}
+
+	return nil
+}
+
+// Requests returns a copy of every request made, oldest first
+func (s *Server) Requests() []pim.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]pim.Request{}, s.requests...)
+}
+
+// Active returns a copy of the user's active assignments, expired ones are removed first
+func (s *Server) Active() []pim.RoleAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	return append([]pim.RoleAssignment{}, s.active...)
+}
+
+// ===== Internal state helpers, these must be called with the lock held =====
+
+func (s *Server) now() time.Time {
+	return time.Now().UTC().Add(s.offset)
+}
+
+// group returns the group with the given name, creating it if it doesn't exist
+func (s *Server) group(name string) pim.Resource {
+	if g, ok := s.groups[name]; ok {
+		return g
+	}
+
+	g := pim.Resource{ID: uuid.NewString(), DisplayName: name, Type: "Group"}
+	s.groups[name] = g
+
+	return g
+}
+
+// role returns the role definition for a group & role, creating it if it doesn't exist
+func (s *Server) role(group pim.Resource, name string) pim.RoleDefinition {
+	key := group.ID + "/" + strings.ToLower(name)
+	if r, ok := s.roles[key]; ok {
+		return r
+	}
+
+	r := pim.RoleDefinition{ID: uuid.NewString(), DisplayName: name}
+	s.roles[key] = r
+
+	return r
+}
+
+// expire removes activations & eligibility which have ended
+func (s *Server) expire() {
+	now := s.now()
+	ended := func(a pim.RoleAssignment) bool { return !a.EndDateTime.IsZero() && !a.EndDateTime.After(now) }
+
+	s.active = remove(s.active, ended)
+	s.eligible = remove(s.eligible, ended)
+}
+
+// pendingRequest finds a request which is waiting for approval
+func (s *Server) pendingRequest(id string) (*pim.Request, error) {
+	for i := range s.requests {
+		r := &s.requests[i]
+		if r.ID != id {
+			continue
+		}
+
+		if r.Status.SubStatus != "PendingApproval" {
+			return nil, fmt.Errorf("request %s is not pending approval, it's %s", id, r.Status.SubStatus)
+		}
+
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("request %s not found", id)
+}
+
+// grant provisions a request, making the role active until the end of the requested duration
+func (s *Server) grant(r *pim.Request, subStatus string) {
+	start := s.now()
+	end := start.Add(r.RequestedDuration())
+
+	r.Status = pim.RequestStatus{Status: "Accepted", SubStatus: subStatus}
+	r.RoleAssignmentStartDateTime = start
+	r.RoleAssignmentEndDateTime = end
+
+	s.active = append(s.active, pim.RoleAssignment{
+		ID:              uuid.NewString(),
+		ResourceID:      r.ResourceID,
+		RoleDefinition:  r.RoleDefinition,
+		Resource:        r.Resource,
+		AssignmentState: "Active",
+		MemberType:      "Direct",
+		EndDateTime:     end,
+		Status:          "Provisioned",
+	})
+}
+
+// remove returns the assignments without those matching the function
+func remove(assignments []pim.RoleAssignment, match func(pim.RoleAssignment) bool) []pim.RoleAssignment {
+	kept := []pim.RoleAssignment{}
+
+	for _, a := range assignments {
+		if !match(a) {
+			kept = append(kept, a)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,207 @@
+// ===========================================================================================
+// Tests for the fake server, driven with the PIM API client
+// ===========================================================================================
+
+package pimtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+	"github.com/benc-uk/pim-cli/pkg/pimtest"
+)
+
+// newServer starts a fake server with the user eligible for Admins (Member), and a client for it
+func newServer(t *testing.T) (*pimtest.Server, *pim.Client) {
+	t.Helper()
+
+	s := pimtest.NewServer()
+	t.Cleanup(s.Close)
+
+	s.AddEligible("Admins", "Member", time.Time{})
+
+	return s, pim.NewClient(s.Credential(), &pim.ClientOptions{Cloud: s.Cloud()})
+}
+
+// requestPending activates Admins (Member) with approval required, returning the pending request ID
+func requestPending(t *testing.T, s *pimtest.Server, c *pim.Client) string {
+	t.Helper()
+
+	s.RequireApproval("Admins", true)
+
+	resp, err := c.RequestPIMGroupActivation(context.Background(), s.User.ID, "Admins", "", time.Hour, "Member")
+	if !errors.Is(err, pim.ErrApprovalRequired) {
+		t.Fatalf("expected ErrApprovalRequired, got %v", err)
+	}
+
+	return resp.ID
+}
+
+func TestApprove(t *testing.T) {
+	s, c := newServer(t)
+	id := requestPending(t, s, c)
+
+	if len(s.Active()) != 0 {
+		t.Fatal("expected nothing active before approval")
+	}
+
+	if err := s.Approve(id); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+
+	if len(s.Active()) != 1 {
+		t.Fatal("expected the role to be active once approved")
+	}
+
+	if status := s.Requests()[0].Status.SubStatus; status != "AdminApproved" {
+		t.Errorf("expected the request to be AdminApproved, got %s", status)
+	}
+
+	if err := s.Approve(id); err == nil {
+		t.Error("expected approving twice to fail")
+	}
+}
+
+func TestDeny(t *testing.T) {
+	s, c := newServer(t)
+	id := requestPending(t, s, c)
+
+	if err := s.Deny(id); err != nil {
+		t.Fatalf("failed to deny: %v", err)
+	}
+
+	if len(s.Active()) != 0 {
+		t.Fatal("expected nothing active once denied")
+	}
+
+	if status := s.Requests()[0].Status.SubStatus; status != "AdminDenied" {
+		t.Errorf("expected the request to be AdminDenied, got %s", status)
+	}
+
+	pending, err := c.ListPendingPIMRequests(context.Background(), s.User.ID)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("expected no pending requests, got %d, %v", len(pending), err)
+	}
+
+	if err := s.Deny("not-a-request"); err == nil {
+		t.Error("expected denying an unknown request to fail")
+	}
+}
+
+func TestAdvanceExpires(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+	s.AddEligible("Readers", "Member", s.Now().Add(24*time.Hour))
+
+	if _, err := c.RequestPIMGroupActivation(ctx, s.User.ID, "Admins", "", time.Hour, "Member"); err != nil {
+		t.Fatalf("activation failed: %v", err)
+	}
+
+	s.Advance(59 * time.Minute)
+
+	if len(s.Active()) != 1 {
+		t.Fatal("expected the activation to last an hour")
+	}
+
+	s.Advance(2 * time.Minute)
+
+	if len(s.Active()) != 0 {
+		t.Fatal("expected the activation to expire after an hour")
+	}
+
+	s.Advance(24 * time.Hour)
+
+	eligible, err := c.ListEligiblePIMGroups(ctx, s.User.ID)
+	if err != nil {
+		t.Fatalf("failed to list eligible groups: %v", err)
+	}
+
+	// Only the permanent eligibility is left
+	if len(eligible) != 1 || eligible[0].Resource.DisplayName != "Admins" {
+		t.Errorf("expected the Readers eligibility to expire, got %+v", eligible)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	for i := range 6 {
+		group := fmt.Sprintf("Group %d", i+1)
+		s.AddEligible(group, "Member", time.Time{})
+
+		if _, err := c.RequestPIMGroupActivation(ctx, s.User.ID, group, "", time.Hour, "Member"); err != nil {
+			t.Fatalf("activation failed: %v", err)
+		}
+	}
+
+	s.PageSize = 4
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.URL+"/api/v2/privilegedAccess/aadGroups/roleAssignmentRequests?$filter=subjectId+eq+'"+s.User.ID+"'", nil)
+	req.Header.Set("Authorization", "Bearer "+s.Credential().Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	var page struct {
+		Value    []pim.Request `json:"value"`
+		NextLink string        `json:"@odata.nextLink"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("failed to decode page: %v", err)
+	}
+
+	if len(page.Value) != 4 || page.NextLink == "" {
+		t.Fatalf("expected a page of 4 with a next link, got %d, %q", len(page.Value), page.NextLink)
+	}
+
+	now := s.Now()
+
+	requests, err := c.ListRequestHistory(ctx, s.User.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil || len(requests) != 6 {
+		t.Fatalf("expected the client to follow the next link to all 6 requests, got %d, %v", len(requests), err)
+	}
+}
+
+func TestFaultTimes(t *testing.T) {
+	s, c := newServer(t)
+	ctx := context.Background()
+
+	fault := pimtest.ServerError("/roleAssignments")
+	fault.Times = 2
+	s.Inject(fault)
+
+	for i := range 2 {
+		var pimErr *pim.PimError
+		if _, err := c.ListEligiblePIMGroups(ctx, s.User.ID); !errors.As(err, &pimErr) || pimErr.HTTPStatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected request %d to fail with a 500, got %v", i+1, err)
+		}
+	}
+
+	if _, err := c.ListEligiblePIMGroups(ctx, s.User.ID); err != nil {
+		t.Fatalf("expected the fault to be used up after 2 requests, got %v", err)
+	}
+
+	// Faults only apply to matching paths
+	s.Inject(pimtest.Throttle("/roleAssignmentRequests"))
+
+	if _, err := c.ListEligiblePIMGroups(ctx, s.User.ID); err != nil {
+		t.Errorf("expected a fault for another path not to apply, got %v", err)
+	}
+
+	if _, err := c.ListPendingPIMRequests(ctx, s.User.ID); !errors.Is(err, pim.ErrThrottled) {
+		t.Errorf("expected ErrThrottled, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+// ==============================================================================================
+// Compliance report of a user's PIM activations over a period, e.g. as evidence for access
+// reviews. Includes a per-group summary and a detailed listing of every request
+// ===============================================================================================
+
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/pim"
+)
+
+// Supported output formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatCSV, FormatJSON, FormatHTML}
+
+// Report is the full compliance report
+type Report struct {
+	User      string         `json:"user"`
+	Tenant    string         `json:"tenant"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Generated time.Time      `json:"generated"`
+	Summary   []GroupSummary `json:"summary"`
+	Requests  []RequestLine  `json:"requests"`
+}
+
+// GroupSummary summarises the activations of one group & role over the period
+type GroupSummary struct {
+	Group          string   `json:"group"`
+	Role           string   `json:"role"`
+	Activations    int      `json:"activations"`
+	TotalHours     float64  `json:"totalHours"`
+	LongestHours   float64  `json:"longestHours"`
+	Justifications []string `json:"justifications"`
+}
+
+// RequestLine is one request in the detailed listing
+type RequestLine struct {
+	Time           time.Time `json:"time"`
+	Group          string    `json:"group"`
+	Role           string    `json:"role"`
+	Type           string    `json:"type"`
+	Status         string    `json:"status"`
+	RequestedHours float64   `json:"requestedHours"`
+	ActualHours    float64   `json:"actualHours,omitempty"`
+	Reason         string    `json:"reason"`
+	RequestID      string    `json:"requestId"`
+}
+
+// Build creates the report from the user's request history
+func Build(user, tenant string, from, to time.Time, requests []pim.Request) Report {
+	now := time.Now()
+	rep := Report{User: user, Tenant: tenant, From: from, To: to, Generated: now.UTC(),
+		Summary: []GroupSummary{}, Requests: []RequestLine{}}
+
+	activations := pim.Activations(requests, now)
+	actualByID := map[string]time.Duration{}
+	summaries := map[string]*GroupSummary{}
+	seenReasons := map[string]map[string]bool{}
+
+	for _, a := range activations {
+		actualByID[a.Request.ID] = a.Actual
+
+		key := a.Request.Resource.DisplayName + "\x00" + a.Request.RoleDefinition.DisplayName
+		if summaries[key] == nil {
+			summaries[key] = &GroupSummary{
+				Group:          a.Request.Resource.DisplayName,
+				Role:           a.Request.RoleDefinition.DisplayName,
+				Justifications: []string{},
+			}
+			seenReasons[key] = map[string]bool{}
+		}
+
+		s := summaries[key]
+		s.Activations++
+		s.TotalHours += a.Actual.Hours()
+		s.LongestHours = max(s.LongestHours, a.Actual.Hours())
+
+		if a.Request.Reason != "" && !seenReasons[key][a.Request.Reason] {
+			seenReasons[key][a.Request.Reason] = true
+			s.Justifications = append(s.Justifications, a.Request.Reason)
+		}
+	}
+
+	for _, s := range summaries {
+		s.TotalHours = round2(s.TotalHours)
+		s.LongestHours = round2(s.LongestHours)
+		rep.Summary = append(rep.Summary, *s)
+	}
+
+	sort.Slice(rep.Summary, func(i, j int) bool {
+		if rep.Summary[i].Group != rep.Summary[j].Group {
+			return rep.Summary[i].Group < rep.Summary[j].Group
+		}
+
+		return rep.Summary[i].Role < rep.Summary[j].Role
+	})
+
+	for _, r := range requests {
+		rep.Requests = append(rep.Requests, RequestLine{
+			Time:           r.RequestedDateTime,
+			Group:          r.Resource.DisplayName,
+			Role:           r.RoleDefinition.DisplayName,
+			Type:           r.Type,
+			Status:         r.Status.SubStatus,
+			RequestedHours: round2(r.RequestedDuration().Hours()),
+			ActualHours:    round2(actualByID[r.ID].Hours()),
+			Reason:         r.Reason,
+			RequestID:      r.ID,
+		})
+	}
+
+	return rep
+}
+
+// Write outputs the report in the given format
+func (r Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(r)
+	case FormatHTML:
+		return htmlTemplate.Execute(w, r)
+	}
+
+	return fmt.Errorf("unknown report format '%s'", format)
+}
+
+// writeCSV outputs the summary, then a blank line, then the detailed listing
+func (r Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	_ = cw.Write([]string{"Group", "Role", "Activations", "Total Hours", "Longest Hours", "Justifications"})
+	for _, s := range r.Summary {
+		_ = cw.Write([]string{s.Group, s.Role, strconv.Itoa(s.Activations), fmtHours(s.TotalHours), fmtHours(s.LongestHours),
+			strings.Join(s.Justifications, "\n")})
+	}
+
+	_ = cw.Write(nil)
+
+	_ = cw.Write([]string{"Time", "Group", "Role", "Type", "Status", "Requested Hours", "Actual Hours", "Reason", "Request ID"})
+	for _, l := range r.Requests {
+		_ = cw.Write([]string{l.Time.UTC().Format(time.RFC3339), l.Group, l.Role, l.Type, l.Status, fmtHours(l.RequestedHours),
+			fmtHours(l.ActualHours), l.Reason, l.RequestID})
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func round2(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
+
+func fmtHours(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":  func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"time":  func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"hours": fmtHours,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>PIM activation report: {{.User}}</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+  th { background: #eee; }
+  td.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>PIM activation report</h1>
+<p>
+  <b>User:</b> {{.User}}<br>
+  <b>Tenant:</b> {{.Tenant}}<br>
+  <b>Period:</b> {{date .From}} to {{date .To}}<br>
+  <b>Generated:</b> {{time .Generated}}
+</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Group</th><th>Role</th><th>Activations</th><th>Total hours</th><th>Longest (hours)</th><th>Justifications</th></tr>
+{{- range .Summary}}
+<tr><td>{{.Group}}</td><td>{{.Role}}</td><td class="num">{{.Activations}}</td><td class="num">{{hours .TotalHours}}</td>
+<td class="num">{{hours .LongestHours}}</td><td>{{range $i, $j := .Justifications}}{{if $i}}<br>{{end}}{{$j}}{{end}}</td></tr>
+{{- else}}
+<tr><td colspan="6">No activations in this period</td></tr>
+{{- end}}
+</table>
+<h2>Requests</h2>
+<table>
+<tr><th>Time</th><th>Group</th><th>Role</th><th>Type</th><th>Status</th>
+<th>Requested hours</th><th>Actual hours</th><th>Reason</th><th>Request ID</th></tr>
+{{- range .Requests}}
+<tr><td>{{time .Time}}</td><td>{{.Group}}</td><td>{{.Role}}</td><td>{{.Type}}</td><td>{{.Status}}</td>
+<td class="num">{{hours .RequestedHours}}</td><td class="num">{{hours .ActualHours}}</td><td>{{.Reason}}</td><td>{{.RequestID}}</td></tr>
+{{- else}}
+<tr><td colspan="9">No requests in this period</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,86 @@
+// ==============================================================================================
+// Request & correlation IDs, sent with every request and captured from responses, so failures
+// can be matched up with server side logs when raising a support case with Microsoft
+// ===============================================================================================
+
+package trace
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header used to send our own ID for each request, the APIs echo it back & log it
+const ClientRequestIDHeader = "client-request-id"
+
+// RequestIDs identifies a request to Microsoft support
+type RequestIDs struct {
+	// RequestID is the ID assigned by the server
+	RequestID string
+	// ClientRequestID is the ID we generated & sent with the request
+	ClientRequestID string
+	// Timestamp is when the server handled the request
+	Timestamp time.Time
+}
+
+// SetHeaders sets a new client request ID and the user agent on a request
+func SetHeaders(req *http.Request, userAgent string) {
+	req.Header.Set(ClientRequestIDHeader, uuid.NewString())
+	req.Header.Set("User-Agent", userAgent)
+}
+
+// IDsFromResponse gets the request IDs from the response headers, falling back to what was sent
+func IDsFromResponse(resp *http.Response) RequestIDs {
+	ids := RequestIDs{
+		RequestID:       firstHeader(resp.Header, "x-ms-request-id", "request-id"),
+		ClientRequestID: firstHeader(resp.Header, ClientRequestIDHeader, "x-ms-client-request-id"),
+	}
+
+	if ids.ClientRequestID == "" && resp.Request != nil {
+		ids.ClientRequestID = resp.Request.Header.Get(ClientRequestIDHeader)
+	}
+
+	if t, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		ids.Timestamp = t.UTC()
+	}
+
+	return ids
+}
+
+// String formats the IDs for including in error messages, empty if there are none
+func (ids RequestIDs) String() string {
+	parts := []string{}
+
+	if ids.RequestID != "" {
+		parts = append(parts, "request-id: "+ids.RequestID)
+	}
+
+	if ids.ClientRequestID != "" {
+		parts = append(parts, "client-request-id: "+ids.ClientRequestID)
+	}
+
+	if !ids.Timestamp.IsZero() {
+		parts = append(parts, "time: "+ids.Timestamp.Format(time.RFC3339))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(parts, ", "))
+}
+
+// firstHeader returns the value of the first of the headers that is set
+func firstHeader(header http.Header, names ...string) string {
+	for _, name := range names {
+		if v := header.Get(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
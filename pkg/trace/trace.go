@@ -0,0 +1,201 @@
+// ==============================================================================================
+// HTTP tracing transport shared by the PIM & Graph clients, logs requests & responses at the
+// debug level set with -v or --debug. Tokens & other secrets are always redacted
+// ===============================================================================================
+
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benc-uk/pim-cli/pkg/output"
+)
+
+// Bodies longer than this are truncated in the log
+const maxBodyLog = 64 * 1024
+
+// Idle keep-alive connections kept per host, the default of 2 is too few for concurrent requests
+const maxIdleConnsPerHost = 16
+
+// Headers which identify a request, for matching up with server side logs & support tickets
+var correlationHeaders = []string{
+	"client-request-id",
+	"x-ms-client-request-id",
+	"request-id",
+	"x-ms-request-id",
+	"x-ms-correlation-request-id",
+	"x-ms-ags-diagnostic",
+}
+
+// Headers whose values are never logged
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// Secrets in JSON bodies, form bodies & query strings, and anything which looks like a JWT
+var (
+	secretJSONRegex = regexp.MustCompile(`"(access_token|refresh_token|id_token|client_secret|client_assertion|assertion|password)"\s*:\s*"[^"]*"`)
+	secretFormRegex = regexp.MustCompile(`\b(access_token|refresh_token|id_token|client_secret|client_assertion|assertion|password|code)=[^&\s]*`)
+	jwtRegex        = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// Transport logs each request made through the wrapped transport
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewClient returns an HTTP client which traces requests, to be shared by all API clients
+func NewClient() *http.Client {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConnsPerHost = maxIdleConnsPerHost
+
+	return &http.Client{Transport: &Transport{Base: base}}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if output.DebugLevel() == output.DebugOff {
+		return t.Base.RoundTrip(req)
+	}
+
+	if output.DebugLevel() >= output.DebugFull {
+		detail := strings.TrimSuffix(formatHeaders(req.Header)+requestBody(req), "\n")
+		output.Debugf(output.DebugFull, "--> %s %s\n%s", req.Method, Redact(req.URL.String()), detail)
+	}
+
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		output.Debugf(output.DebugRequests, "%s %s failed after %s: %v", req.Method, Redact(req.URL.String()), latency, err)
+		return resp, err
+	}
+
+	output.Debugf(output.DebugRequests, "%s %s %d %s%s", req.Method, Redact(req.URL.String()), resp.StatusCode, latency,
+		correlation(req.Header, resp.Header))
+
+	if output.DebugLevel() >= output.DebugFull {
+		detail := strings.TrimSuffix(formatHeaders(resp.Header)+responseBody(resp), "\n")
+		output.Debugf(output.DebugFull, "<-- %s\n%s", resp.Status, detail)
+	}
+
+	return resp, nil
+}
+
+// Redact removes tokens & other secrets from a URL, header value or body
+func Redact(s string) string {
+	s = secretJSONRegex.ReplaceAllString(s, `"$1":"[REDACTED]"`)
+	s = secretFormRegex.ReplaceAllString(s, `$1=[REDACTED]`)
+
+	return jwtRegex.ReplaceAllString(s, "[REDACTED JWT]")
+}
+
+// correlation formats the correlation headers of a request & response
+func correlation(reqHeader, respHeader http.Header) string {
+	ids := []string{}
+
+	for _, name := range correlationHeaders {
+		if v := respHeader.Get(name); v != "" {
+			ids = append(ids, name+"="+v)
+		} else if v := reqHeader.Get(name); v != "" {
+			ids = append(ids, name+"="+v)
+		}
+	}
+
+	if len(ids) == 0 {
+		return ""
+	}
+
+	return " [" + strings.Join(ids, " ") + "]"
+}
+
+// formatHeaders formats headers one per line, sorted, with secrets redacted
+func formatHeaders(header http.Header) string {
+	header = RedactHeaders(header)
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	for _, name := range names {
+		fmt.Fprintf(&b, "    %s: %s\n", name, strings.Join(header[name], ", "))
+	}
+
+	return b.String()
+}
+
+// RedactHeaders returns a copy of the headers with secrets removed, secret headers have their whole value replaced
+func RedactHeaders(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+
+	for name, values := range header {
+		for _, v := range values {
+			if secretHeaders[strings.ToLower(name)] {
+				v = "[REDACTED]"
+			}
+
+			redacted[name] = append(redacted[name], Redact(v))
+		}
+	}
+
+	return redacted
+}
+
+// requestBody reads the request body for logging, and puts it back so it can still be sent
+func requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return fmt.Sprintf("    <failed to read body: %v>\n", err)
+	}
+
+	return formatBody(body)
+}
+
+// responseBody reads the response body for logging, and puts it back so it can still be read
+func responseBody(resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return fmt.Sprintf("    <failed to read body: %v>\n", err)
+	}
+
+	return formatBody(body)
+}
+
+// formatBody formats a body for the log, redacted & truncated
+func formatBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	s := string(body)
+	if len(s) > maxBodyLog {
+		s = s[:maxBodyLog] + fmt.Sprintf("... (%d bytes truncated)", len(body)-maxBodyLog)
+	}
+
+	return "    " + Redact(s) + "\n"
+}